@@ -0,0 +1,36 @@
+// Command mockidp is a minimal OpenID Connect provider for trying out single
+// sign-on locally. It signs in whoever enters an email address, so never expose it.
+package main
+
+import (
+	"GoProjects/TaskTracker/internal/config"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/oidc/mockidp"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	logger.Init()
+	defer logger.Sync()
+
+	issuer := config.String("MOCKIDP_ISSUER", "http://localhost:9400")
+	p, err := mockidp.New(mockidp.Config{
+		Issuer: issuer,
+		// Browsers may reach the provider under another name than the app does.
+		PublicURL:    config.String("MOCKIDP_PUBLIC_URL", issuer),
+		ClientID:     config.String("MOCKIDP_CLIENT_ID", "tasktracker"),
+		ClientSecret: config.String("MOCKIDP_CLIENT_SECRET", "tasktracker-secret"),
+		RedirectURIs: strings.Fields(config.String("MOCKIDP_REDIRECT_URIS", "http://localhost:8080/auth/oidc/callback")),
+	})
+	if err != nil {
+		logger.Log.Fatal("key generation failed", zap.Error(err))
+	}
+
+	addr := config.String("MOCKIDP_ADDR", ":9400")
+	logger.Log.Info("mock identity provider listening", zap.String("addr", addr), zap.String("issuer", issuer))
+	if err := http.ListenAndServe(addr, p.Handler()); err != nil {
+		logger.Log.Fatal("server error", zap.Error(err))
+	}
+}
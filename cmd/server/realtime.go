@@ -0,0 +1,44 @@
+package main
+
+import (
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/queue"
+	"GoProjects/TaskTracker/internal/realtime"
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+)
+
+// relayRealtime sends the messages the worker publishes to the realtime
+// exchange, such as the tasks it imported, to the WebSocket clients of their
+// user. Every server consumes a queue of its own, so all of them get each one.
+func relayRealtime(ctx context.Context, broker *queue.Broker, hub *realtime.Hub) {
+	msgs, err := broker.Consume()
+	if err != nil {
+		logger.Log.Fatal("realtime consume error", zap.Error(err))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				logger.Log.Info("realtime channel closed")
+				return
+			}
+
+			var event struct {
+				Type    queue.EventType   `json:"type"`
+				Payload realtime.Delivery `json:"payload"`
+			}
+			if err := json.Unmarshal(msg.Body, &event); err != nil || event.Type != queue.EventRealtime {
+				logger.Log.Warn("bad realtime event", zap.String("type", string(event.Type)), zap.Error(err))
+				msg.Nack(false, false)
+				continue
+			}
+			hub.BroadcastTo(event.Payload.UserID, event.Payload.Message)
+			msg.Ack(false)
+		}
+	}
+}
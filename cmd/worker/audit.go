@@ -0,0 +1,66 @@
+package main
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"time"
+)
+
+// auditRetryDelay is how long a failed append waits before the entry is retried.
+const auditRetryDelay = 5 * time.Second
+
+// consumeAudit appends the entries of the audit queue to the audit log, one at
+// a time and in queue order. Entries that can't be stored go back to the queue.
+func consumeAudit(ctx context.Context, broker *queue.Broker, auditStore *store.AuditStore) {
+	msgs, err := broker.Consume()
+	if err != nil {
+		logger.Log.Fatal("audit consume error", zap.Error(err))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				logger.Log.Info("audit channel closed")
+				return
+			}
+
+			var event queue.EventMessage
+			var e models.AuditEvent
+			err := json.Unmarshal(msg.Body, &event)
+			if err == nil {
+				err = decodePayload(event, &e)
+			}
+			if err != nil || event.Type != queue.EventAuditRecorded {
+				logger.Log.Warn("bad audit event", zap.String("type", string(event.Type)), zap.Error(err))
+				msg.Nack(false, false)
+				continue
+			}
+
+			entry, err := audit.Entry(e)
+			if err == nil {
+				err = auditStore.Append(ctx, entry)
+			}
+			if err != nil {
+				logger.Log.Error("audit append failed", zap.String("action", e.Action), zap.Error(err))
+				select {
+				case <-ctx.Done():
+				case <-time.After(auditRetryDelay):
+				}
+				msg.Nack(false, true)
+				continue
+			}
+			logger.Log.Info("📝 Audit entry recorded",
+				zap.Int64("id", entry.ID), zap.String("action", entry.Action))
+			msg.Ack(false)
+		}
+	}
+}
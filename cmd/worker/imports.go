@@ -0,0 +1,257 @@
+package main
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/cache"
+	"GoProjects/TaskTracker/internal/importer"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
+	"GoProjects/TaskTracker/internal/realtime"
+	"GoProjects/TaskTracker/internal/store"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// importProgressEvery is how many rows are processed between progress updates.
+// The tasks of those rows are created in the same transaction.
+const importProgressEvery = 100
+
+type importJob struct {
+	ImportID int `json:"import_id"`
+}
+
+// importRunner runs the imports requested through the queue.
+type importRunner struct {
+	imports *store.ImportStore
+	tasks   *store.TaskStore
+	broker  *queue.Broker
+	// realtime reaches the servers, which broadcast imported tasks.
+	realtime *queue.Broker
+	cache    *cache.RedisCache
+	// staleAfter is how long an import may run before it's presumed abandoned.
+	staleAfter time.Duration
+	// slots bounds how many imports run at once; its capacity is the limit.
+	slots   chan struct{}
+	running sync.WaitGroup
+}
+
+// importRow is a parsed row waiting to be created.
+type importRow struct {
+	row  int
+	task *models.Task
+}
+
+// reclaim requests stale imports again every interval, so that imports of a
+// worker that died are finished by another one.
+func (ir *importRunner) reclaim(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ids, err := ir.imports.Stale(ctx, ir.staleAfter)
+		if err != nil {
+			logger.Log.Error("stale import lookup failed", zap.Error(err))
+			continue
+		}
+		for _, id := range ids {
+			logger.Log.Warn("reclaiming stale import", zap.Int("import_id", id))
+			if err := ir.broker.PublishEvent(queue.EventImportRequested, importJob{ImportID: id}); err != nil {
+				logger.Log.Error("Publish error", zap.Error(err))
+			}
+		}
+	}
+}
+
+// start runs the import in the background once a slot is free, so that
+// imports don't hold up other events.
+func (ir *importRunner) start(ctx context.Context, id int) {
+	ir.running.Add(1)
+	go func() {
+		defer ir.running.Done()
+		select {
+		case <-ctx.Done():
+			return
+		case ir.slots <- struct{}{}:
+		}
+		defer func() { <-ir.slots }()
+		ir.run(ctx, id)
+	}()
+}
+
+// wait blocks until the started imports returned.
+func (ir *importRunner) wait() {
+	ir.running.Wait()
+}
+
+// run parses the uploaded file of a pending import and creates a task per row.
+// Each task is audited as created by the user who uploaded the file. A
+// reclaimed import skips the rows processed before.
+func (ir *importRunner) run(ctx context.Context, id int) {
+	imp, payload, err := ir.imports.Claim(ctx, id, ir.staleAfter)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.Log.Warn("import not pending", zap.Int("import_id", id))
+			return
+		}
+		logger.Log.Error("import claim failed", zap.Int("import_id", id), zap.Error(err))
+		return
+	}
+	if imp.Errors == nil {
+		imp.Errors = []models.ImportRowError{}
+	}
+	resume := imp.ProcessedRows
+
+	defer func() {
+		if err := ir.imports.Finish(context.Background(), imp); err != nil {
+			logger.Log.Error("import finish failed", zap.Int("import_id", id), zap.Error(err))
+		}
+		err := ir.broker.PublishEvent(queue.EventImportFinished, map[string]interface{}{
+			"import_id": imp.ID,
+			"user_id":   imp.UserID,
+			"status":    imp.Status,
+			"created":   imp.CreatedRows,
+			"failed":    imp.FailedRows,
+		})
+		if err != nil {
+			logger.Log.Error("Publish error", zap.Error(err))
+		}
+	}()
+
+	parser, ok := importer.Get(imp.Format)
+	if !ok {
+		imp.Status = models.ImportFailed
+		imp.Error = "unknown format " + imp.Format
+		return
+	}
+
+	// Count rows first so that clients can show a percentage.
+	imp.TotalRows = 0
+	err = parser.Parse(bytes.NewReader(payload), imp.Mapping, func(importer.Record) error {
+		imp.TotalRows++
+		return nil
+	})
+	if err != nil {
+		imp.Status = models.ImportFailed
+		imp.Error = err.Error()
+		return
+	}
+
+	var pending []importRow
+	seen := 0
+	err = parser.Parse(bytes.NewReader(payload), imp.Mapping, func(rec importer.Record) error {
+		seen++
+		if seen <= resume {
+			return nil
+		}
+		imp.ProcessedRows++
+
+		if rec.Err != nil {
+			failImportRow(imp, rec.Row, rec.Err.Error())
+		} else {
+			patch := models.TaskPatch{Title: &rec.Title, Description: &rec.Description, Status: &rec.Status}
+			if errs := patch.Validate(); len(errs) > 0 {
+				failImportRow(imp, rec.Row, errs[0].Field+": "+errs[0].Message)
+			} else {
+				t := &models.Task{Title: rec.Title, Description: rec.Description, Status: rec.Status, UserID: imp.UserID}
+				pending = append(pending, importRow{row: rec.Row, task: t})
+			}
+		}
+
+		if imp.ProcessedRows%importProgressEvery == 0 {
+			if err := ir.flush(ctx, imp, pending); err != nil {
+				return err
+			}
+			pending = pending[:0]
+		}
+		return ctx.Err()
+	})
+	if err == nil {
+		err = ir.flush(ctx, imp, pending)
+	}
+	if err != nil {
+		imp.Status = models.ImportFailed
+		imp.Error = err.Error()
+		return
+	}
+
+	imp.Status = models.ImportCompleted
+}
+
+func failImportRow(imp *models.Import, row int, msg string) {
+	imp.FailedRows++
+	if len(imp.Errors) < models.MaxImportErrors {
+		imp.Errors = append(imp.Errors, models.ImportRowError{Row: row, Message: msg})
+	}
+}
+
+// flush creates the tasks of the rows and saves the progress of the import in
+// one transaction, then announces the tasks. A row whose task can't be created
+// fails on its own.
+func (ir *importRunner) flush(ctx context.Context, imp *models.Import, rows []importRow) error {
+	var created []*models.Task
+	err := ir.tasks.InTx(ctx, func(tx *store.TaskStore) error {
+		for _, r := range rows {
+			// A nested transaction is a savepoint, undoing only this row.
+			err := tx.InTx(ctx, func(tx *store.TaskStore) error {
+				return tx.Create(ctx, r.task)
+			})
+			if err != nil {
+				failImportRow(imp, r.row, "could not create task")
+				logger.Log.Error("import row failed", zap.Int("import_id", imp.ID), zap.Int("row", r.row), zap.Error(err))
+				continue
+			}
+			created = append(created, r.task)
+		}
+		imp.CreatedRows += len(created)
+		if err := tx.SaveImportProgress(ctx, imp); err != nil {
+			imp.CreatedRows -= len(created)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(created) > 0 {
+		ir.announce(imp.UserID, created)
+	}
+	return nil
+}
+
+// announce audits the imported tasks as created by their owner, publishes
+// task.created events for them, has the servers send them to the clients of
+// their owner and drops the cached task list of their owner.
+func (ir *importRunner) announce(userID int, created []*models.Task) {
+	for _, t := range created {
+		e := audit.TaskEvent(models.AuditTaskCreated, nil, t)
+		e.ActorID = audit.Actor(userID)
+		audit.Publish(e)
+		if err := ir.broker.PublishEvent(queue.EventTaskCreated, t); err != nil {
+			logger.Log.Error("Publish error", zap.Error(err))
+		}
+	}
+	err := ir.realtime.PublishEvent(queue.EventRealtime, realtime.Delivery{
+		UserID: userID,
+		Message: realtime.Message{
+			Type: "tasks_batch",
+			Data: map[string]interface{}{"created": created},
+		},
+	})
+	if err != nil {
+		logger.Log.Error("Publish error", zap.Error(err))
+	}
+	_ = ir.cache.Delete("tasks:user:" + strconv.Itoa(userID))
+}
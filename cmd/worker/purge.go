@@ -0,0 +1,108 @@
+package main
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/blob"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+const purgeBatchSize = 500
+
+// trashPurger permanently deletes tasks that stayed in the trash too long,
+// together with their attachment files.
+type trashPurger struct {
+	tasks       *store.TaskStore
+	attachments *store.AttachmentStore
+	blobs       blob.BlobStore
+	broker      *queue.Broker
+}
+
+// run purges tasks that stayed in the trash longer than retention, checking
+// every interval, and audits and emits a task.purged event for each.
+func (p *trashPurger) run(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *trashPurger) purge(ctx context.Context, retention time.Duration) {
+	before := time.Now().Add(-retention)
+	// Files of attachments are deleted once their rows are gone, including
+	// those left over by earlier runs.
+	defer p.deleteBlobs(ctx)
+
+	for {
+		var purged []*models.Task
+		err := p.tasks.InTx(ctx, func(tx *store.TaskStore) error {
+			var err error
+			purged, err = tx.PurgeDeleted(ctx, before, purgeBatchSize)
+			return err
+		})
+		if err != nil {
+			logger.Log.Error("trash purge failed", zap.Error(err))
+			return
+		}
+
+		now := time.Now()
+		for _, t := range purged {
+			// Purges have no actor.
+			e := audit.TaskEvent(models.AuditTaskPurged, t, nil)
+			e.OccurredAt = now
+			audit.Publish(e)
+			err := p.broker.PublishEvent(queue.EventTaskPurged, map[string]interface{}{
+				"id":         t.ID,
+				"user_id":    t.UserID,
+				"deleted_at": t.DeletedAt,
+			})
+			if err != nil {
+				logger.Log.Error("Publish error", zap.Error(err))
+			}
+		}
+		if len(purged) > 0 {
+			logger.Log.Info("🗑 Trash purged", zap.Int("count", len(purged)))
+		}
+		if len(purged) < purgeBatchSize {
+			return
+		}
+	}
+}
+
+// deleteBlobs deletes the files of deleted and purged attachments. Files that
+// can't be deleted stay queued for the next run.
+func (p *trashPurger) deleteBlobs(ctx context.Context) {
+	for {
+		keys, err := p.attachments.OrphanedBlobs(ctx, purgeBatchSize)
+		if err != nil {
+			logger.Log.Error("attachment purge failed", zap.Error(err))
+			return
+		}
+		for _, key := range keys {
+			if err := p.blobs.Delete(ctx, key); err != nil {
+				logger.Log.Error("attachment purge failed", zap.String("key", key), zap.Error(err))
+				return
+			}
+			if err := p.attachments.BlobDeleted(ctx, key); err != nil {
+				logger.Log.Error("attachment purge failed", zap.String("key", key), zap.Error(err))
+				return
+			}
+		}
+		if len(keys) < purgeBatchSize {
+			return
+		}
+	}
+}
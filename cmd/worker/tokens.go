@@ -0,0 +1,49 @@
+package main
+
+import (
+	"GoProjects/TaskTracker/internal/auth"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+// purgeRefreshTokens deletes expired refresh tokens, the sessions whose last
+// refresh token expired and expired password reset and verification tokens
+// every interval. Rotated and revoked tokens are kept until they expire, so
+// that reuse can be detected.
+func purgeRefreshTokens(ctx context.Context, tokens *store.RefreshTokenStore, sessions *store.SessionStore,
+	userTokens *store.UserTokenStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := tokens.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			logger.Log.Error("refresh token purge failed", zap.Error(err))
+		} else if n > 0 {
+			logger.Log.Info("🔑 Expired refresh tokens purged", zap.Int64("count", n))
+		}
+
+		n, err = sessions.DeleteExpired(ctx, time.Now().Add(-auth.RefreshTokenTTL))
+		if err != nil {
+			logger.Log.Error("session purge failed", zap.Error(err))
+		} else if n > 0 {
+			logger.Log.Info("🔑 Expired sessions purged", zap.Int64("count", n))
+		}
+
+		n, err = userTokens.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			logger.Log.Error("user token purge failed", zap.Error(err))
+		} else if n > 0 {
+			logger.Log.Info("🔑 Expired user tokens purged", zap.Int64("count", n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package audit records security-relevant and data-changing actions. Entries
+// travel through their own queue to the worker, whose audit consumer appends
+// them to the hash-chained audit log.
+package audit
+
+import (
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// broker receives the entries once set through Use.
+var broker *queue.Broker
+
+// Use makes Record and Publish publish to the audit queue of b. Without it
+// nothing is recorded.
+func Use(b *queue.Broker) {
+	broker = b
+}
+
+// Record completes the event with the actor, address and request id of r and
+// publishes it. An actor set on the event wins over the authenticated user,
+// e.g. for logins.
+func Record(r *http.Request, e models.AuditEvent) {
+	if broker == nil {
+		return
+	}
+	if e.ActorID == nil {
+		if userID, ok := r.Context().Value("userID").(int); ok {
+			e.ActorID = &userID
+		}
+	}
+	e.IP = clientIP(r)
+	e.RequestID, _ = r.Context().Value("requestID").(string)
+	e.OccurredAt = time.Now()
+	Publish(e)
+}
+
+// Publish sends the event to the audit queue before returning. Events without
+// a time are stamped now. Failures are logged.
+func Publish(e models.AuditEvent) {
+	if broker == nil {
+		return
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	if err := broker.PublishEvent(queue.EventAuditRecorded, e); err != nil {
+		logger.Log.Error("audit publish failed", zap.String("action", e.Action), zap.Error(err))
+	}
+}
+
+// Entry turns the event into the entry that is stored for it.
+func Entry(e models.AuditEvent) (*models.AuditEntry, error) {
+	diff, err := Diff(e.Before, e.After)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuditEntry{
+		OccurredAt: e.OccurredAt,
+		Action:     e.Action,
+		ActorID:    e.ActorID,
+		IP:         e.IP,
+		RequestID:  e.RequestID,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Diff:       diff,
+	}, nil
+}
+
+// TaskEvent describes the change of a task. before or after is nil for tasks
+// that didn't exist on that side.
+func TaskEvent(action string, before, after *models.Task) models.AuditEvent {
+	e := models.AuditEvent{Action: action, TargetType: "task"}
+	if before != nil {
+		e.TargetID = strconv.Itoa(before.ID)
+		e.Before = before
+	}
+	if after != nil {
+		e.TargetID = strconv.Itoa(after.ID)
+		e.After = after
+	}
+	return e
+}
+
+// Actor returns a pointer to the id, for events that name their actor.
+func Actor(userID int) *int {
+	return &userID
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Diff compares the JSON forms of before and after field by field and returns
+// the changed fields with their "from" and "to" values. A side that is nil
+// leaves out its values, so creations only have "to" and deletions only "from".
+func Diff(before, after interface{}) (json.RawMessage, error) {
+	from, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := map[string]map[string]interface{}{}
+	for name, value := range from {
+		if other, ok := to[name]; ok && reflect.DeepEqual(value, other) {
+			continue
+		}
+		diff[name] = map[string]interface{}{"from": value}
+	}
+	for name, value := range to {
+		if old, ok := from[name]; ok && reflect.DeepEqual(old, value) {
+			continue
+		}
+		if diff[name] == nil {
+			diff[name] = map[string]interface{}{}
+		}
+		diff[name]["to"] = value
+	}
+	return json.Marshal(diff)
+}
+
+// fields returns the JSON object fields of v. Values that aren't objects are
+// kept under "value".
+func fields(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err == nil {
+		return object, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"value": value}, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"strings"
+)
+
+// AccessTokenPrefix starts every personal access token, telling them apart from
+// JWTs and making leaked ones easy to scan for.
+const AccessTokenPrefix = "ttp_"
+
+// accessTokenPrefixLen is how much of a token is kept to recognise it by.
+const accessTokenPrefixLen = len(AccessTokenPrefix) + 6
+
+var ErrAccessTokenInvalid = errors.New("invalid access token")
+
+// accessTokens is consulted by ParseAccessToken once set through UseAccessTokens.
+var accessTokens *store.AccessTokenStore
+
+// UseAccessTokens makes ParseAccessToken accept the tokens kept in s.
+func UseAccessTokens(s *store.AccessTokenStore) {
+	accessTokens = s
+}
+
+// IsAccessToken reports whether the bearer token is a personal access token.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// NewAccessToken returns a new personal access token and its prefix to show.
+func NewAccessToken() (token, prefix string, err error) {
+	random, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	token = AccessTokenPrefix + random
+	return token, token[:accessTokenPrefixLen], nil
+}
+
+// ParseAccessToken returns the stored personal access token. Unknown, revoked
+// and expired tokens give ErrAccessTokenInvalid.
+func ParseAccessToken(ctx context.Context, token string) (*models.AccessToken, error) {
+	if accessTokens == nil || !IsAccessToken(token) {
+		return nil, ErrAccessTokenInvalid
+	}
+	t, err := accessTokens.Authenticate(ctx, HashToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAccessTokenInvalid
+	}
+	return t, err
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"GoProjects/TaskTracker/internal/cache"
+	"strconv"
+	"time"
+)
+
+// Denylist keeps the ids (jti) of revoked access tokens and the ids of revoked
+// sessions until the tokens concerned expire anyway.
+type Denylist struct {
+	Cache *cache.RedisCache
+}
+
+func denylistKey(jti string) string {
+	return "jwt:denylist:" + jti
+}
+
+func sessionDenylistKey(sid int) string {
+	return "jwt:denylist:session:" + strconv.Itoa(sid)
+}
+
+// Revoke denies the token with the given id until expiresAt.
+func (d *Denylist) Revoke(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return d.Cache.Set(denylistKey(jti), "1", ttl)
+}
+
+// RevokeSession denies all access tokens of the session. Sessions get no new
+// access tokens once revoked, so it's enough to remember it for their lifetime.
+func (d *Denylist) RevokeSession(sid int) error {
+	return d.Cache.Set(sessionDenylistKey(sid), "1", AccessTokenTTL+time.Minute)
+}
+
+// IsRevoked reports whether the token itself or its session was revoked.
+func (d *Denylist) IsRevoked(claims *Claims) (bool, error) {
+	var keys []string
+	if claims.ID != "" {
+		keys = append(keys, denylistKey(claims.ID))
+	}
+	if claims.SessionID != 0 {
+		keys = append(keys, sessionDenylistKey(claims.SessionID))
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+	return d.Cache.Exists(keys...)
+}
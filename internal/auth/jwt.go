@@ -1,47 +1,146 @@
 package auth
 
 import (
+	"GoProjects/TaskTracker/internal/config"
+	"GoProjects/TaskTracker/internal/logger"
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
 	"os"
+	"strconv"
 	"time"
 )
 
+// ErrTokenRevoked is returned by ParseToken for revoked tokens.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// ErrRevocationUnknown is returned by ParseToken when the denylist can't be
+// reached, unless DenylistFailOpen is set.
+var ErrRevocationUnknown = errors.New("token revocation could not be checked")
+
+// DenylistFailOpen lets tokens through while the denylist can't be reached.
+// It keeps users signed in during a Redis outage, but so are revoked tokens
+// until they expire, so it's off unless DENYLIST_FAIL_OPEN is set.
+var DenylistFailOpen = config.Bool("DENYLIST_FAIL_OPEN", false)
+
+// jwtSecret verifies HS256 tokens issued before signing keys were introduced.
+// They are only accepted while JWT_SECRET is set; it can be dropped once they
+// all expired. Without a key set it still signs new tokens.
 var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 
+// Issuer is the iss claim of access tokens, for services verifying them.
+var Issuer = config.String("JWT_ISSUER", "tasktracker")
+
+// AccessTokenTTL is the lifetime of access tokens. They can't be refreshed, only
+// replaced through a refresh token, so a stolen one is useful only briefly.
+var AccessTokenTTL = config.Duration("ACCESS_TOKEN_TTL", 15*time.Minute)
+
+// RefreshTokenTTL is how long a refresh token can be exchanged for new tokens.
+var RefreshTokenTTL = config.Duration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
 type Claims struct {
 	UserID int `json:"user_id"`
+	// SessionID is the login session the token was issued for.
+	SessionID int `json:"sid,omitempty"`
+	// EmailUnverified marks users who haven't confirmed their email address yet.
+	EmailUnverified bool `json:"email_unverified,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int) (string, error) {
-	claims := Claims{
-		UserID: userID,
+// revocations is consulted by ParseToken once set through UseDenylist.
+var revocations *Denylist
+
+// UseDenylist makes ParseToken reject tokens revoked through d.
+func UseDenylist(d *Denylist) {
+	revocations = d
+}
+
+// keys signs and verifies tokens once set through UseKeys.
+var keys *KeySet
+
+// UseKeys makes GenerateToken sign with the keys of ks and ParseToken accept them.
+func UseKeys(ks *KeySet) {
+	keys = ks
+}
+
+// GenerateToken issues an access token of the session with a unique id (jti),
+// so that it can be revoked before it expires.
+func GenerateToken(userID, sessionID int, emailVerified bool) (string, *Claims, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	claims := &Claims{
+		UserID:          userID,
+		SessionID:       sessionID,
+		EmailUnverified: !emailVerified,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			Issuer:    Issuer,
+			Subject:   strconv.Itoa(userID),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	var signed string
+	if keys != nil {
+		signed, err = keys.sign(claims)
+	} else if len(jwtSecret) > 0 {
+		signed, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	} else {
+		err = errors.New("no key to sign tokens with")
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
 }
 
-// Парсим токен, получаем id пользователя
-func ParseToken(tokenStr string) (int, error) {
+// Парсим токен, получаем claims. Tokens that were revoked, alone or with their
+// session, are rejected. If the denylist can't be reached ParseToken returns
+// ErrRevocationUnknown, see DenylistFailOpen.
+func ParseToken(tokenStr string) (*Claims, error) {
 	if tokenStr == "" {
-		return 0, errors.New("token is empty")
+		return nil, errors.New("token is empty")
 	}
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, claims, verificationKey, jwt.WithValidMethods([]string{
+		jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodHS256.Alg(),
+	}), jwt.WithIssuer(Issuer))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	if !token.Valid {
-		return 0, errors.New("invalid token")
+		return nil, errors.New("invalid token")
 	}
+	if revocations != nil {
+		revoked, err := revocations.IsRevoked(claims)
+		if err != nil {
+			logger.Log.Error("denylist check failed", zap.Error(err), zap.Bool("fail_open", DenylistFailOpen))
+			if !DenylistFailOpen {
+				return nil, ErrRevocationUnknown
+			}
+		} else if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
 
-	return claims.UserID, nil
+// verificationKey picks the key for the token: the shared secret for legacy
+// HS256 tokens, else the key named by its kid header.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		if len(jwtSecret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return jwtSecret, nil
+	}
+	if keys == nil {
+		return nil, errors.New("no signing keys configured")
+	}
+	return keys.publicKey(token)
 }
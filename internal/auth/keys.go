@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"GoProjects/TaskTracker/internal/config"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// KeySet holds the asymmetric keys signing and verifying access tokens. The
+// keys live in the database, so every server signs with the same key; each one
+// reloads them regularly and adds a new key when rotation is due.
+type KeySet struct {
+	Store *store.SigningKeyStore
+	// Algorithm of new keys, RS256 or EdDSA.
+	Algorithm string
+	// Rotation is how long a key signs before a new one takes over.
+	Rotation time.Duration
+	// Publish is how long a new key is announced through the JWKS before it
+	// signs, so that other services can pick it up in time.
+	Publish time.Duration
+	// Refresh is how often keys are reloaded and rotation is checked.
+	Refresh time.Duration
+	// KEK encrypts the private keys in the database.
+	KEK cipher.AEAD
+
+	mu   sync.RWMutex
+	keys []*signingKey // the most recently activated first
+}
+
+type signingKey struct {
+	kid         string
+	method      jwt.SigningMethod
+	private     crypto.PrivateKey
+	public      crypto.PublicKey
+	activatesAt time.Time
+}
+
+// NewKeySet configures the key set from JWT_ALGORITHM, JWT_KEY_ROTATION,
+// JWT_KEY_PUBLISH and JWT_KEY_REFRESH. JWT_KEY_ENCRYPTION_KEY, 32 bytes in
+// base64, is required to encrypt the private keys with.
+func NewKeySet(s *store.SigningKeyStore) (*KeySet, error) {
+	ks := &KeySet{
+		Store:     s,
+		Algorithm: config.String("JWT_ALGORITHM", jwt.SigningMethodRS256.Alg()),
+		Rotation:  config.Duration("JWT_KEY_ROTATION", 30*24*time.Hour),
+		Publish:   config.Duration("JWT_KEY_PUBLISH", time.Hour),
+		Refresh:   config.Duration("JWT_KEY_REFRESH", time.Minute),
+	}
+	if _, err := methodOf(ks.Algorithm); err != nil {
+		return nil, err
+	}
+	if ks.Publish <= ks.Refresh {
+		return nil, errors.New("JWT_KEY_PUBLISH must be longer than JWT_KEY_REFRESH")
+	}
+	kek, err := newKEK(config.String("JWT_KEY_ENCRYPTION_KEY", ""))
+	if err != nil {
+		return nil, err
+	}
+	ks.KEK = kek
+	return ks, nil
+}
+
+// newKEK returns AES-256-GCM with the base64 encoded key.
+func newKEK(encoded string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be 32 bytes in base64")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the private key of kid. The kid is authenticated with it, so
+// a key can't be passed off as another.
+func (ks *KeySet) seal(kid string, privateDER []byte) ([]byte, error) {
+	nonce := make([]byte, ks.KEK.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return ks.KEK.Seal(nonce, nonce, privateDER, []byte(kid)), nil
+}
+
+// open decrypts a private key sealed by seal.
+func (ks *KeySet) open(kid string, sealed []byte) ([]byte, error) {
+	size := ks.KEK.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.New("encrypted private key too short")
+	}
+	return ks.KEK.Open(nil, sealed[:size], sealed[size:], []byte(kid))
+}
+
+func methodOf(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+// Load rotates the keys if due and reloads them.
+func (ks *KeySet) Load(ctx context.Context) error {
+	// Tokens signed with a replaced key stay valid until they expire.
+	grace := AccessTokenTTL + time.Minute
+	rotated, err := ks.Store.Rotate(ctx, time.Now().Add(-ks.Rotation), ks.Publish, grace, ks.generate)
+	if err != nil {
+		return fmt.Errorf("rotate signing keys: %w", err)
+	}
+	if rotated {
+		logger.Log.Info("signing key added", zap.String("algorithm", ks.Algorithm))
+	}
+
+	stored, err := ks.Store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("load signing keys: %w", err)
+	}
+	keys := make([]*signingKey, 0, len(stored))
+	for _, k := range stored {
+		if !k.Encrypted {
+			if err := ks.sealStored(ctx, k); err != nil {
+				return fmt.Errorf("encrypt signing key %s: %w", k.KID, err)
+			}
+		}
+		key, err := ks.parse(k)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", k.KID, err)
+		}
+		keys = append(keys, key)
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+// Run reloads the keys every Refresh until ctx is done.
+func (ks *KeySet) Run(ctx context.Context) {
+	ticker := time.NewTicker(ks.Refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Load(ctx); err != nil {
+				logger.Log.Error("signing keys refresh failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// generate creates a key pair of the configured algorithm.
+func (ks *KeySet) generate() (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch ks.Algorithm {
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := ks.seal(kid, privateDER)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SigningKey{KID: kid, Algorithm: ks.Algorithm, PrivateKey: sealed, PublicKey: publicDER,
+		Encrypted: true}, nil
+}
+
+// sealStored encrypts a key stored before keys were encrypted, in the database
+// and in k.
+func (ks *KeySet) sealStored(ctx context.Context, k *models.SigningKey) error {
+	sealed, err := ks.seal(k.KID, k.PrivateKey)
+	if err != nil {
+		return err
+	}
+	if err := ks.Store.SealPrivateKey(ctx, k.KID, sealed); err != nil {
+		return err
+	}
+	k.PrivateKey, k.Encrypted = sealed, true
+	return nil
+}
+
+func (ks *KeySet) parse(k *models.SigningKey) (*signingKey, error) {
+	method, err := methodOf(k.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	privateDER, err := ks.open(k.KID, k.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt private key: %w", err)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(privateDER)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.ParsePKIXPublicKey(k.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: k.KID, method: method, private: private, public: public, activatesAt: k.ActivatesAt}, nil
+}
+
+// sign signs the claims with the most recently activated key.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	for _, k := range ks.keys {
+		if k.activatesAt.After(now) {
+			continue
+		}
+		token := jwt.NewWithClaims(k.method, claims)
+		token.Header["kid"] = k.kid
+		return token.SignedString(k.private)
+	}
+	return "", errors.New("no active signing key")
+}
+
+// publicKey returns the key verifying the token, chosen by its kid header.
+func (ks *KeySet) publicKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.kid != kid {
+			continue
+		}
+		if k.method.Alg() != token.Method.Alg() {
+			return nil, errors.New("token algorithm doesn't match its key")
+		}
+		return k.public, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKS returns the public keys verifying access tokens, including keys that
+// will only start signing later.
+func (ks *KeySet) JWKS() models.JSONWebKeySet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := models.JSONWebKeySet{Keys: make([]models.JSONWebKey, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		jwk := models.JSONWebKey{Use: "sig", KeyID: k.kid, Algorithm: k.method.Alg()}
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"GoProjects/TaskTracker/internal/cache"
+	"GoProjects/TaskTracker/internal/config"
+	"GoProjects/TaskTracker/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lockout counts failed logins per account and per client address, and failed
+// second factors per user. Past the free attempts every failure locks the
+// account, address or second factor for twice as long as the one before, from
+// BaseDelay up to MaxDelay.
+type Lockout struct {
+	Cache *cache.RedisCache
+	// FreeAttempts is how many logins to an account may fail without delay.
+	FreeAttempts int64
+	// IPFreeAttempts is the same for a client address, which may be shared.
+	IPFreeAttempts int64
+	// MFAFreeAttempts is the same for the second factor of a user.
+	MFAFreeAttempts int64
+	BaseDelay       time.Duration
+	// MaxDelay is the longest lock. Reaching it counts as a lockout.
+	MaxDelay time.Duration
+	// Window is how long failures are counted from the first one.
+	Window time.Duration
+}
+
+// Lock is a lock set by a failed login.
+type Lock struct {
+	Scope    string
+	Failures int64
+	Delay    time.Duration
+}
+
+// NewLockout configures the lockout from LOGIN_FREE_ATTEMPTS,
+// LOGIN_IP_FREE_ATTEMPTS, MFA_FREE_ATTEMPTS, LOGIN_BASE_DELAY, LOGIN_LOCKOUT
+// and LOGIN_FAILURE_WINDOW.
+func NewLockout(c *cache.RedisCache) *Lockout {
+	return &Lockout{
+		Cache:           c,
+		FreeAttempts:    config.Int64("LOGIN_FREE_ATTEMPTS", 3),
+		IPFreeAttempts:  config.Int64("LOGIN_IP_FREE_ATTEMPTS", 20),
+		MFAFreeAttempts: config.Int64("MFA_FREE_ATTEMPTS", 5),
+		BaseDelay:       config.Duration("LOGIN_BASE_DELAY", time.Second),
+		MaxDelay:        config.Duration("LOGIN_LOCKOUT", 15*time.Minute),
+		Window:          config.Duration("LOGIN_FAILURE_WINDOW", time.Hour),
+	}
+}
+
+// accountKey identifies the account by a hash of its email, which works the
+// same whether the account exists or not.
+func accountKey(email string) string {
+	return models.LockoutAccount + ":" + HashToken(strings.ToLower(strings.TrimSpace(email)))
+}
+
+func ipKey(ip string) string {
+	return models.LockoutIP + ":" + ip
+}
+
+func mfaKey(userID int) string {
+	return models.LockoutMFA + ":" + strconv.Itoa(userID)
+}
+
+func failuresKey(key string) string {
+	return "login:failures:" + key
+}
+
+func lockKey(key string) string {
+	return "login:lock:" + key
+}
+
+// Check returns how long logins to the account or from the address are still
+// locked, or 0.
+func (l *Lockout) Check(email, ip string) (time.Duration, error) {
+	return l.check(accountKey(email), ipKey(ip))
+}
+
+// CheckMFA returns how long the second factor of the user is still locked, or 0.
+func (l *Lockout) CheckMFA(userID int) (time.Duration, error) {
+	return l.check(mfaKey(userID))
+}
+
+func (l *Lockout) check(keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range keys {
+		ttl, err := l.Cache.TTL(lockKey(key))
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, ttl)
+	}
+	return wait, nil
+}
+
+// Fail records a failed login and returns the locks it set.
+func (l *Lockout) Fail(email, ip string) ([]Lock, error) {
+	var locks []Lock
+	for _, scope := range []struct {
+		name string
+		key  string
+		free int64
+	}{
+		{models.LockoutAccount, accountKey(email), l.FreeAttempts},
+		{models.LockoutIP, ipKey(ip), l.IPFreeAttempts},
+	} {
+		lock, err := l.fail(scope.name, scope.key, scope.free)
+		if err != nil {
+			return locks, err
+		}
+		if lock != nil {
+			locks = append(locks, *lock)
+		}
+	}
+	return locks, nil
+}
+
+// FailMFA records a wrong second factor of the user and returns the lock it
+// set, if any. Every login needs the password first, so counting per login
+// alone would allow unlimited guesses.
+func (l *Lockout) FailMFA(userID int) (*Lock, error) {
+	return l.fail(models.LockoutMFA, mfaKey(userID), l.MFAFreeAttempts)
+}
+
+func (l *Lockout) fail(scope, key string, free int64) (*Lock, error) {
+	n, err := l.Cache.Incr(failuresKey(key), l.Window)
+	if err != nil {
+		return nil, err
+	}
+	delay := l.delay(n - free)
+	if delay <= 0 {
+		return nil, nil
+	}
+	if err := l.Cache.Set(lockKey(key), "1", delay); err != nil {
+		return nil, err
+	}
+	return &Lock{Scope: scope, Failures: n, Delay: delay}, nil
+}
+
+// delay returns the lock after the given number of failures beyond the free ones.
+func (l *Lockout) delay(over int64) time.Duration {
+	if over <= 0 {
+		return 0
+	}
+	d := l.BaseDelay
+	for i := int64(1); i < over && d < l.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, l.MaxDelay)
+}
+
+// Reset forgets the failures of the account after a successful login. Those of
+// the address stay, so that signing in to one account doesn't clear guessing
+// at others.
+func (l *Lockout) Reset(email string) error {
+	key := accountKey(email)
+	return l.Cache.DeleteMany(failuresKey(key), lockKey(key))
+}
+
+// ResetMFA forgets the failed second factors of the user after a good one.
+func (l *Lockout) ResetMFA(userID int) error {
+	key := mfaKey(userID)
+	return l.Cache.DeleteMany(failuresKey(key), lockKey(key))
+}
@@ -1,13 +1,29 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"golang.org/x/crypto/bcrypt"
+	"sync"
+)
+
+// dummyHash is checked against when there is no password to compare, so that
+// the response takes as long as one for a wrong password.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("no password"), bcrypt.DefaultCost)
+	return hash
+})
 
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
 }
 
+// CheckPassword compares the password with its hash. An empty hash, e.g. of an
+// unknown user or one without a password, never matches but takes as long.
 func CheckPassword(hashedPassword, plainPassword string) bool {
+	if hashedPassword == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(plainPassword))
+		return false
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
 	return err == nil
 }
@@ -0,0 +1,56 @@
+// Package blob stores opaque binary objects such as task attachments.
+package blob
+
+import (
+	"GoProjects/TaskTracker/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotFound is returned when an object doesn't exist.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrChecksumMismatch is returned by Put when the stored bytes don't match Object.SHA256.
+var ErrChecksumMismatch = errors.New("blob checksum mismatch")
+
+// Object describes the bytes passed to Put.
+type Object struct {
+	Size        int64
+	ContentType string
+	// SHA256 is the hex encoded digest of the content. Stores verify it while writing.
+	SHA256 string
+}
+
+// BlobStore keeps objects under flat, slash separated keys.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, obj Object) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewFromEnv builds the store selected by BLOB_BACKEND: "local" (default) keeps
+// objects under BLOB_DIR, "s3" talks to any S3 compatible service.
+func NewFromEnv(ctx context.Context) (BlobStore, error) {
+	switch backend := config.String("BLOB_BACKEND", "local"); backend {
+	case "local":
+		return NewLocalStore(config.String("BLOB_DIR", "./data/blobs"))
+	case "s3":
+		s := &S3Store{
+			Endpoint:  config.String("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Region:    config.String("S3_REGION", "us-east-1"),
+			Bucket:    config.String("S3_BUCKET", "attachments"),
+			AccessKey: config.String("S3_ACCESS_KEY", ""),
+			SecretKey: config.String("S3_SECRET_KEY", ""),
+		}
+		if config.Bool("S3_CREATE_BUCKET", false) {
+			if err := s.CreateBucket(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", backend)
+	}
+}
@@ -0,0 +1,152 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func object(content []byte) Object {
+	sum := sha256.Sum256(content)
+	return Object{Size: int64(len(content)), ContentType: "text/plain", SHA256: hex.EncodeToString(sum[:])}
+}
+
+// exerciseStore runs the behavior every BlobStore has to share against s.
+func exerciseStore(t *testing.T, s BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+	content := []byte("screenshot of the failing build")
+
+	if err := s.Put(ctx, "tasks/1/a.txt", bytes.NewReader(content), object(content)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	body, err := s.Get(ctx, "tasks/1/a.txt")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Get returned %q, want %q", got, content)
+	}
+
+	bad := object(content)
+	bad.SHA256 = strings.Repeat("0", 64)
+	err = s.Put(ctx, "tasks/1/b.txt", bytes.NewReader(content), bad)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Put with a wrong checksum returned %v, want ErrChecksumMismatch", err)
+	}
+	if _, err := s.Get(ctx, "tasks/1/b.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("object with a wrong checksum was stored: Get returned %v", err)
+	}
+
+	if err := s.Delete(ctx, "tasks/1/a.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, "tasks/1/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "tasks/1/a.txt"); err != nil {
+		t.Fatalf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exerciseStore(t, s)
+}
+
+func TestLocalStoreRejectsKeysOutsideDir(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("x")
+	for _, key := range []string{"", "/etc/passwd", "../outside", "tasks/../../outside"} {
+		if err := s.Put(context.Background(), key, bytes.NewReader(content), object(content)); err == nil {
+			t.Errorf("Put accepted key %q", key)
+		}
+	}
+}
+
+// fakeS3 is an in-memory stand-in for the object API of S3. Like S3 it checks
+// the signed payload digest, but not the signature itself.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		if digest := r.Header.Get("X-Amz-Content-Sha256"); digest != "UNSIGNED-PAYLOAD" && digest != hex.EncodeToString(sum[:]) {
+			http.Error(w, "<Error><Code>XAmzContentSHA256Mismatch</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = body
+	case http.MethodGet:
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	srv := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	defer srv.Close()
+
+	exerciseStore(t, &S3Store{Endpoint: srv.URL, Region: "us-east-1", Bucket: "attachments",
+		AccessKey: "test", SecretKey: "test-secret"})
+}
+
+// TestS3StoreMinIO runs against the MinIO of deploy/docker-compose.yml, which also
+// checks the signatures, when S3_TEST_ENDPOINT is set, e.g. to http://localhost:9000.
+func TestS3StoreMinIO(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	s := &S3Store{Endpoint: endpoint, Region: "us-east-1", Bucket: "attachments-test",
+		AccessKey: envOr("S3_TEST_ACCESS_KEY", "minio"), SecretKey: envOr("S3_TEST_SECRET_KEY", "minio-secret")}
+	if err := s.CreateBucket(context.Background()); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	exerciseStore(t, s)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -24,14 +24,59 @@ func (r *RedisCache) Set(key string, value string, ttl time.Duration) error {
 	return r.client.Set(r.ctx, key, value, ttl).Err()
 }
 
+// SetNX sets the key only if it doesn't exist yet and reports whether it did.
+func (r *RedisCache) SetNX(key string, value string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(r.ctx, key, value, ttl).Result()
+}
+
 func (r *RedisCache) Get(key string) (string, error) {
 	return r.client.Get(r.ctx, key).Result()
 }
 
+// Incr increments the counter at key and returns its new value. A new counter
+// expires after ttl.
+func (r *RedisCache) Incr(key string, ttl time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(r.ctx, key)
+	pipe.ExpireNX(r.ctx, key, ttl)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// Take returns the value of the key and deletes it, so it can be taken only once.
+func (r *RedisCache) Take(key string) (string, error) {
+	return r.client.GetDel(r.ctx, key).Result()
+}
+
+// Exists reports whether any of the keys is set.
+func (r *RedisCache) Exists(keys ...string) (bool, error) {
+	n, err := r.client.Exists(r.ctx, keys...).Result()
+	return n > 0, err
+}
+
+// TTL returns how long the key lives on, or 0 when it doesn't exist or never expires.
+func (r *RedisCache) TTL(key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(r.ctx, key).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
 func (r *RedisCache) Delete(key string) error {
 	return r.client.Del(r.ctx, key).Err()
 }
 
+// DeleteMany removes all keys in a single round-trip.
+func (r *RedisCache) DeleteMany(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(r.ctx, keys...).Err()
+}
+
 func (r *RedisCache) Close() error {
 	return r.client.Close()
 }
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// String returns the value of the environment variable key or def when it is unset.
+func String(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// Int returns the environment variable key parsed as int or def when it is unset or invalid.
+func Int(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Int64 returns the environment variable key parsed as int64 or def when it is unset or invalid.
+func Int64(key string, def int64) int64 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Duration returns the environment variable key parsed by time.ParseDuration
+// or def when it is unset or invalid.
+func Duration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Bool returns the environment variable key parsed by strconv.ParseBool or def when it is unset or invalid.
+func Bool(key string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
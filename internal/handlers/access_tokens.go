@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/auth"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/store"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxAccessTokenName = 100
+
+type AccessTokenHandler struct {
+	Store *store.AccessTokenStore
+}
+
+// RegisterAccessTokenRoutes adds the management of personal access tokens,
+// which takes a login rather than a token.
+func RegisterAccessTokenRoutes(r chi.Router, s *store.AccessTokenStore) {
+	h := &AccessTokenHandler{Store: s}
+
+	r = r.With(RejectAccessTokens)
+	r.Get("/auth/tokens", h.ListAccessTokens)
+	r.Post("/auth/tokens", h.CreateAccessToken)
+	r.Delete("/auth/tokens/{tokenID}", h.RevokeAccessToken)
+}
+
+// ListAccessTokens godoc
+// @Summary      List personal access tokens
+// @Description  Returns the personal access tokens of the authenticated user that weren't
+// @Description  revoked, newest first. Only the start of each token is shown.
+// @Tags         auth
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.AccessToken
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "not allowed with a personal access token"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/tokens [get]
+func (h *AccessTokenHandler) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.Store.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// CreateAccessToken godoc
+// @Summary      Create personal access token
+// @Description  Creates a token for scripts to call the API as the authenticated user, sent as
+// @Description  "Bearer <token>". Its scopes (tasks:read, tasks:write) limit what it can do;
+// @Description  without expires_at it works until revoked. The token is only returned here.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security 	 BearerAuth
+// @Param        request  body      models.CreateAccessTokenRequest  true  "Name, scopes and expiry"
+// @Success      201  {object}  models.AccessTokenCreated
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "not allowed with a personal access token"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/tokens [post]
+func (h *AccessTokenHandler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAccessTokenName {
+		http.Error(w, "name is required and has at most "+strconv.Itoa(maxAccessTokenName)+" characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			http.Error(w, "unknown scope "+scope+", valid are "+strings.Join(models.Scopes, ", "), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	token, prefix, err := auth.NewAccessToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slices.Sort(req.Scopes)
+	t := &models.AccessToken{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		Scopes:    slices.Compact(req.Scopes),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.Store.Create(r.Context(), t, auth.HashToken(token)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditTokenCreated,
+		TargetType: "access_token",
+		TargetID:   strconv.Itoa(t.ID),
+		After:      t,
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, models.AccessTokenCreated{AccessToken: *t, Token: token})
+}
+
+// RevokeAccessToken godoc
+// @Summary      Revoke personal access token
+// @Description  Revokes a personal access token of the authenticated user; it stops working
+// @Description  right away.
+// @Tags         auth
+// @Param        tokenID  path  int  true  "Token ID"
+// @Security 	 BearerAuth
+// @Success      204
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "not allowed with a personal access token"
+// @Failure      404  {string}  string "token not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/tokens/{tokenID} [delete]
+func (h *AccessTokenHandler) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Store.Revoke(r.Context(), userID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, models.AuditEvent{Action: models.AuditTokenRevoked, TargetType: "access_token", TargetID: strconv.Itoa(id)})
+	w.WriteHeader(http.StatusNoContent)
+}
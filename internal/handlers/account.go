@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/auth"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/mail"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	// mailThrottle is the least time between two emails of a kind to a user.
+	mailThrottle      = time.Minute
+	minPasswordLength = 8
+)
+
+// sendToken creates a token for the purpose and emails the user a link to
+// path carrying it. Emails of a kind go out to an address at most once per
+// mailThrottle.
+func (h *AuthHandler) sendToken(ctx context.Context, user *models.User, purpose string, ttl time.Duration,
+	path, subject, text string) error {
+	key := "mail:throttle:" + purpose + ":" + strconv.Itoa(user.ID) + ":" + strings.ToLower(user.Email)
+	first, err := h.Cache.SetNX(key, "1", mailThrottle)
+	if err != nil || !first {
+		return err
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := h.UserTokens.Create(ctx, user.ID, purpose, user.Email, auth.HashToken(token), time.Now().Add(ttl)); err != nil {
+		return err
+	}
+
+	link := h.AppURL + path + "?token=" + url.QueryEscape(token)
+	return h.Broker.PublishEvent(queue.EventMailRequested, mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    text + "\n\n" + link + "\n\nThe link expires in " + ttl.String() + ". If you didn't ask for it, ignore this email.\n",
+	})
+}
+
+func (h *AuthHandler) sendVerification(ctx context.Context, user *models.User) error {
+	return h.sendToken(ctx, user, models.TokenEmailVerification, emailVerificationTTL, "/verify-email",
+		"Verify your email address", "Confirm the email address of your TaskTracker account:")
+}
+
+// ForgotPassword godoc
+// @Summary      Request password reset
+// @Description  Emails a link to reset the password, valid for an hour and only once. The response
+// @Description  is the same whether or not an account with the email exists.
+// @Tags         auth
+// @Accept       json
+// @Param        request  body  models.ForgotPasswordRequest  true  "Email"
+// @Success      202
+// @Failure      400  {string}  string "invalid input"
+// @Router       /auth/password/forgot [post]
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Store.GetByEmail(r.Context(), req.Email)
+	if err == nil {
+		err = h.sendToken(r.Context(), user, models.TokenPasswordReset, passwordResetTTL, "/reset-password",
+			"Reset your password", "Choose a new password for your TaskTracker account:")
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		logger.Log.Error("password reset mail failed", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword godoc
+// @Summary      Reset password
+// @Description  Sets a new password with the token of a reset email. All sessions of the account
+// @Description  are signed out and its personal access tokens revoked. The address counts as
+// @Description  verified, as the email was received.
+// @Tags         auth
+// @Accept       json
+// @Param        request  body  models.ResetPasswordRequest  true  "Token and new password"
+// @Success      204
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "invalid or expired token"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/password/reset [post]
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, "password must have at least "+strconv.Itoa(minPasswordLength)+" characters", http.StatusBadRequest)
+		return
+	}
+	hashed, err := auth.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userID, email, err := h.UserTokens.Consume(r.Context(), models.TokenPasswordReset, auth.HashToken(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Store.SetPassword(r.Context(), userID, hashed); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The address may have changed since; then the new one isn't vouched for.
+	if err := h.Store.MarkEmailVerified(r.Context(), userID, email); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sessions, err := h.Sessions.RevokeAll(r.Context(), userID)
+	if err == nil {
+		err = denySessions(h.Denylist, sessions)
+	}
+	var tokens int64
+	if err == nil {
+		tokens, err = h.AccessTokens.RevokeAll(r.Context(), userID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("password reset", zap.Int("user_id", userID), zap.Int("sessions_revoked", len(sessions)),
+		zap.Int64("access_tokens_revoked", tokens))
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditPasswordReset,
+		ActorID:    audit.Actor(userID),
+		TargetType: "user",
+		TargetID:   strconv.Itoa(userID),
+		After:      map[string]int64{"sessions_revoked": int64(len(sessions)), "access_tokens_revoked": tokens},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail godoc
+// @Summary      Verify email address
+// @Description  Confirms the email address with the token of a verification email. Links sent to
+// @Description  an address the account no longer has don't work. Tokens issued before carry the
+// @Description  unverified state until they are refreshed.
+// @Tags         auth
+// @Accept       json
+// @Param        request  body  models.VerifyEmailRequest  true  "Token"
+// @Success      204
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "invalid or expired token"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/verify-email [post]
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, email, err := h.UserTokens.Consume(r.Context(), models.TokenEmailVerification, auth.HashToken(req.Token))
+	if err == nil {
+		err = h.Store.MarkEmailVerified(r.Context(), userID, email)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification godoc
+// @Summary      Resend verification email
+// @Description  Sends a new verification link; earlier links stop working.
+// @Tags         auth
+// @Security 	 BearerAuth
+// @Success      202
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      409  {string}  string "already verified"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/verify-email/resend [post]
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.Store.Get(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		http.Error(w, "email address already verified", http.StatusConflict)
+		return
+	}
+	if err := h.sendVerification(r.Context(), user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
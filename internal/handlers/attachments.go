@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/blob"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/realtime"
+	"GoProjects/TaskTracker/internal/store"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type AttachmentHandler struct {
+	Tasks   *store.TaskStore
+	Store   *store.AttachmentStore
+	Blobs   blob.BlobStore
+	Hub     *realtime.Hub
+	MaxSize int64
+}
+
+func RegisterAttachmentRoutes(r chi.Router, tasks *store.TaskStore, s *store.AttachmentStore, blobs blob.BlobStore, hub *realtime.Hub, maxSize int64) {
+	h := &AttachmentHandler{Tasks: tasks, Store: s, Blobs: blobs, Hub: hub, MaxSize: maxSize}
+
+	r.Route("/tasks/{id}/attachments", func(r chi.Router) {
+		r.Get("/", h.ListAttachments)
+		r.Post("/", h.UploadAttachment)
+		r.Get("/{attachmentID}", h.DownloadAttachment)
+		r.Delete("/{attachmentID}", h.DeleteAttachment)
+	})
+}
+
+// loadAttachment loads the {attachmentID} of the user's task {id}.
+func (h *AttachmentHandler) loadAttachment(w http.ResponseWriter, r *http.Request) (*models.Attachment, bool) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "attachmentID"))
+	if err != nil {
+		http.Error(w, "invalid attachment id", http.StatusBadRequest)
+		return nil, false
+	}
+	a, err := h.Store.Get(r.Context(), task.ID, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "attachment not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return a, true
+}
+
+// ListAttachments godoc
+// @Summary      List task attachments
+// @Tags         attachments
+// @Produce      json
+// @Param        id   path      int  true  "Task ID"
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.Attachment
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/attachments [get]
+func (h *AttachmentHandler) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+	attachments, err := h.Store.List(r.Context(), task.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, attachments)
+}
+
+// UploadAttachment godoc
+// @Summary      Upload attachment
+// @Description  Attaches a file to the task. The content type is detected from the file content,
+// @Description  the declared one is ignored. When sha256 is given, the upload is rejected unless
+// @Description  the received file has that digest.
+// @Tags         attachments
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id      path      int     true   "Task ID"
+// @Param        file    formData  file    true   "File to attach"
+// @Param        sha256  formData  string  false  "Hex encoded SHA-256 of the file"
+// @Security 	 BearerAuth
+// @Success      201  {object}  models.Attachment
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      413  {string}  string "file too large"
+// @Failure      422  {string}  string "checksum mismatch"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/attachments [post]
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxSize+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if header.Size > h.MaxSize {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// One pass over the file for the digest and the first 512 bytes for sniffing.
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash := sha256.New()
+	hash.Write(sniff[:n])
+	if _, err := io.Copy(hash, file); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if expected := strings.ToLower(r.FormValue("sha256")); expected != "" && expected != sum {
+		http.Error(w, "checksum mismatch", http.StatusUnprocessableEntity)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rnd := make([]byte, 16)
+	if _, err := rand.Read(rnd); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a := &models.Attachment{
+		TaskID:      task.ID,
+		UserID:      task.UserID,
+		Filename:    filepath.Base(header.Filename),
+		ContentType: http.DetectContentType(sniff[:n]),
+		Size:        header.Size,
+		SHA256:      sum,
+		StorageKey:  fmt.Sprintf("tasks/%d/%s", task.ID, hex.EncodeToString(rnd)),
+	}
+
+	obj := blob.Object{Size: a.Size, ContentType: a.ContentType, SHA256: a.SHA256}
+	if err := h.Blobs.Put(r.Context(), a.StorageKey, file, obj); err != nil {
+		if errors.Is(err, blob.ErrChecksumMismatch) {
+			http.Error(w, "checksum mismatch", http.StatusUnprocessableEntity)
+			return
+		}
+		logger.Log.Error("blob upload failed", zap.Error(err))
+		http.Error(w, "could not store file", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.Create(r.Context(), a); err != nil {
+		_ = h.Blobs.Delete(r.Context(), a.StorageKey)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/tasks/%d/attachments/%d", task.ID, a.ID))
+	writeJSON(w, http.StatusCreated, a)
+	h.Hub.BroadcastTo(a.UserID, realtime.Message{Type: "attachment_added", Data: a})
+}
+
+// DownloadAttachment godoc
+// @Summary      Download attachment
+// @Description  Streams the file. The SHA-256 digest is returned as ETag and Content-Digest.
+// @Tags         attachments
+// @Produce      octet-stream
+// @Param        id            path    int     true   "Task ID"
+// @Param        attachmentID  path    int     true   "Attachment ID"
+// @Param        If-None-Match header  string  false  "ETag of a previously downloaded file"
+// @Security 	 BearerAuth
+// @Success      200  {file}    file
+// @Success      304  {string}  string "not modified"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "attachment not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/attachments/{attachmentID} [get]
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.loadAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	etag := `"` + a.SHA256 + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, err := h.Blobs.Get(r.Context(), a.StorageKey)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			http.Error(w, "attachment not found", http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("blob download failed", zap.Error(err))
+		http.Error(w, "could not read file", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	// Only images are shown inline; anything else, HTML in particular, is
+	// downloaded so it can't run in the API's origin.
+	disposition := "attachment"
+	if strings.HasPrefix(a.ContentType, "image/") && a.ContentType != "image/svg+xml" {
+		disposition = "inline"
+	}
+	digest, _ := hex.DecodeString(a.SHA256)
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest)+":")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, body); err != nil {
+		logger.Log.Warn("attachment download interrupted", zap.Error(err))
+	}
+}
+
+// DeleteAttachment godoc
+// @Summary      Delete attachment
+// @Tags         attachments
+// @Param        id            path  int  true  "Task ID"
+// @Param        attachmentID  path  int  true  "Attachment ID"
+// @Security 	 BearerAuth
+// @Success      204  {string}  string "no content"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "attachment not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/attachments/{attachmentID} [delete]
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.loadAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Store.Delete(r.Context(), a.ID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "attachment not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The file stays queued for the worker if it can't be deleted now.
+	if err := h.Blobs.Delete(r.Context(), a.StorageKey); err != nil {
+		logger.Log.Error("blob delete failed", zap.String("key", a.StorageKey), zap.Error(err))
+	} else if err := h.Store.BlobDeleted(r.Context(), a.StorageKey); err != nil {
+		logger.Log.Error("blob delete failed", zap.String("key", a.StorageKey), zap.Error(err))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	h.Hub.BroadcastTo(a.UserID, realtime.Message{Type: "attachment_deleted", Data: a})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/store"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 500
+)
+
+type AuditHandler struct {
+	Store *store.AuditStore
+}
+
+// RegisterAuditRoutes adds the audit log for admins. It goes after AuthMiddleware.
+func RegisterAuditRoutes(r chi.Router, s *store.AuditStore, users *store.UserStore) {
+	h := &AuditHandler{Store: s}
+
+	r.With(RejectAccessTokens, RequireVerifiedEmail, RequireAdmin(users)).Route("/admin/audit", func(r chi.Router) {
+		r.Get("/", h.ListAudit)
+		r.Get("/verify", h.VerifyAudit)
+	})
+}
+
+// ListAudit godoc
+// @Summary      List audit log
+// @Description  Returns audit log entries, newest first: logins, token and role changes and the
+// @Description  creation, change, deletion and purge of users and tasks. Entries show up once the
+// @Description  worker appended them, usually within seconds. Page with before_id set to the last
+// @Description  id received. Admins only.
+// @Tags         admin
+// @Produce      json
+// @Security 	 BearerAuth
+// @Param        actor_id     query  int     false  "Only entries of this user"
+// @Param        action       query  string  false  "Only this action, e.g. task.updated"
+// @Param        target_type  query  string  false  "Only targets of this type, e.g. task"
+// @Param        target_id    query  string  false  "Only this target, with target_type"
+// @Param        since        query  string  false  "Only entries at or after this time (RFC 3339)"
+// @Param        until        query  string  false  "Only entries before this time (RFC 3339)"
+// @Param        before_id    query  int     false  "Only entries older than this one"
+// @Param        limit        query  int     false  "Maximum number of entries (default 100, max 500)"
+// @Success      200  {array}   models.AuditEntry
+// @Failure      400  {string}  string "invalid filter"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "admin role required"
+// @Failure      500  {string}  string "internal error"
+// @Router       /admin/audit [get]
+func (h *AuditHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	f, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.Store.List(r.Context(), f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func parseAuditFilter(r *http.Request) (store.AuditFilter, error) {
+	q := r.URL.Query()
+	f := store.AuditFilter{
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Limit:      defaultAuditLimit,
+	}
+	var err error
+	if v := q.Get("actor_id"); v != "" {
+		if f.ActorID, err = strconv.Atoi(v); err != nil {
+			return f, errors.New("invalid actor_id")
+		}
+	}
+	if v := q.Get("before_id"); v != "" {
+		if f.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, errors.New("invalid before_id")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > maxAuditLimit {
+			return f, errors.New("invalid limit")
+		}
+	}
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("invalid since")
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("invalid until")
+		}
+	}
+	return f, nil
+}
+
+// VerifyAudit godoc
+// @Summary      Verify audit log
+// @Description  Checks the hash chain of the whole audit log. An entry that was changed, or
+// @Description  one before it removed, breaks the chain at that entry. Admins only.
+// @Tags         admin
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.AuditVerification
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "admin role required"
+// @Failure      500  {string}  string "internal error"
+// @Router       /admin/audit/verify [get]
+func (h *AuditHandler) VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	result, err := h.Store.Verify(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -1,74 +1,164 @@
 package handlers
 
 import (
+	"GoProjects/TaskTracker/internal/audit"
 	"GoProjects/TaskTracker/internal/auth"
+	"GoProjects/TaskTracker/internal/cache"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/metrics"
 	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
 	"GoProjects/TaskTracker/internal/store"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type AuthHandler struct {
-	Store *store.UserStore
+	Store    *store.UserStore
+	Tokens   *store.RefreshTokenStore
+	Sessions *store.SessionStore
+	MFA      *store.MFAStore
+	// UserTokens keeps the tokens of password reset and email verification.
+	UserTokens *store.UserTokenStore
+	// AccessTokens keeps personal access tokens, revoked with the password.
+	AccessTokens *store.AccessTokenStore
+	Denylist     *auth.Denylist
+	Cache        *cache.RedisCache
+	Lockout      *auth.Lockout
+	Broker       *queue.Broker
+	// AppURL is the base of the links in emails.
+	AppURL string
+	// PasswordLogin enables registration and login with a password. Without it
+	// users sign in through single sign-on only.
+	PasswordLogin bool
+	// Settings holds the workspace policies admins set, such as requiring 2FA.
+	Settings *store.SettingsStore
+	// MFARequired makes users set up two-factor authentication before their
+	// first login completes, and keeps them from turning it off, whatever the
+	// workspace settings say.
+	MFARequired bool
 }
 
-func RegisterAuthRoutes(r chi.Router, s *store.UserStore) {
-	h := &AuthHandler{Store: s}
+func RegisterAuthRoutes(r chi.Router, h *AuthHandler) {
+	// Routes for signed-in users, which personal access tokens can't reach.
+	session := r.With(AuthMiddleware, RejectAccessTokens)
 
 	r.Post("/auth/register", h.Register)
 	r.Post("/auth/login", h.Login)
+	r.Post("/auth/refresh", h.Refresh)
+	session.Post("/auth/logout", h.Logout)
+
+	r.Post("/auth/password/forgot", h.ForgotPassword)
+	r.Post("/auth/password/reset", h.ResetPassword)
+	r.Post("/auth/verify-email", h.VerifyEmail)
+	session.Post("/auth/verify-email/resend", h.ResendVerification)
+
+	r.Post("/auth/mfa/verify", h.VerifyMFA)
+	r.Post("/auth/mfa/enroll", h.EnrollMFA)
+	r.Post("/auth/mfa/enable", h.EnableMFA)
+	session.Get("/auth/mfa", h.GetMFA)
+	session.Delete("/auth/mfa", h.DisableMFA)
 }
 
 // Register godoc
 // @Summary      Register new user
-// @Description  Creates a new user account
+// @Description  Creates a new user account and emails a link to verify the address. Until it is
+// @Description  verified the account can only sign in and manage its authentication.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
-// @Param        user  body      models.User  true  "User info"
-// @Success      201   {object}  models.User
+// @Param        user  body      models.RegisterRequest  true  "User info"
+// @Success      201   {object}  models.UserProfile
 // @Failure      400   {string}  string "invalid input"
+// @Failure      403   {string}  string "password login is disabled"
+// @Failure      409   {string}  string "email address already in use"
 // @Failure      500   {string}  string "internal error"
 // @Router       /auth/register [post]
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
-	var u models.User
-	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+	if !h.PasswordLogin {
+		http.Error(w, "password login is disabled, use single sign-on", http.StatusForbidden)
+		return
+	}
+	var req models.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, "password must have at least "+strconv.Itoa(minPasswordLength)+" characters", http.StatusBadRequest)
+		return
+	}
 
-	hashed, err := auth.HashPassword(u.Password)
+	hashed, err := auth.HashPassword(req.Password)
 	if err != nil {
 		http.Error(w, "failed to hashed password", http.StatusInternalServerError)
 		return
 	}
-	u.Password = hashed
+	u := models.User{Email: req.Email, Password: hashed, Name: strings.TrimSpace(req.Name)}
 
-	if err := h.Store.Create(context.Background(), &u); err != nil {
+	err = h.Store.Create(r.Context(), &u)
+	if errors.Is(err, store.ErrEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditUserCreated,
+		ActorID:    audit.Actor(u.ID),
+		TargetType: "user",
+		TargetID:   strconv.Itoa(u.ID),
+		After:      u.Profile(),
+	})
+	if err := h.sendVerification(r.Context(), &u); err != nil {
+		logger.Log.Error("verification mail failed", zap.Int("user_id", u.ID), zap.Error(err))
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(u)
+	_ = json.NewEncoder(w).Encode(u.Profile())
 }
 
 // Login godoc
 // @Summary      Login
-// @Description  Authenticate user and return JWT token
+// @Description  Authenticates the user and returns a short-lived access token (JWT) together
+// @Description  with a refresh token to obtain new ones through /auth/refresh. Users with
+// @Description  two-factor authentication get a models.MFAChallenge instead, to be completed
+// @Description  at /auth/mfa/verify (or /auth/mfa/enroll when enrollment is required).
+// @Description  Repeated failures lock the account and the client address for increasing
+// @Description  periods, answered with 429 and Retry-After.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        credentials  body      models.LoginRequest  true  "Email and password"
-// @Success      200  {string}  map[string]string "token"
+// @Success      200  {object}  models.TokenResponse
 // @Failure      400  {string}  string "invalid input"
 // @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "password login is disabled"
+// @Failure      429  {string}  string "too many failed attempts, see Retry-After"
 // @Failure      500  {string}  string "internal error"
 // @Router       /auth/login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if !h.PasswordLogin {
+		http.Error(w, "password login is disabled, use single sign-on", http.StatusForbidden)
+		return
+	}
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -79,24 +169,256 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.Store.GetByEmail(context.Background(), req.Email)
+	ip := clientIP(r)
+	wait, err := h.Lockout.Check(req.Email, ip)
 	if err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		// Logins keep working without Redis, only unthrottled.
+		logger.Log.Error("login lockout check failed", zap.Error(err))
+	}
+	if wait > 0 {
+		metrics.LoginFailures.WithLabelValues("locked").Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
 		return
 	}
 
-	if !auth.CheckPassword(user.Password, req.Password) {
+	user, err := h.Store.GetByEmail(r.Context(), req.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Unknown emails take as long as wrong passwords, so they can't be told apart.
+	hashed := ""
+	if user != nil {
+		hashed = user.Password
+	}
+	if !auth.CheckPassword(hashed, req.Password) {
+		h.loginFailed(r, req.Email, ip)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID)
+	// With a second factor the failures are forgotten only once it checks out,
+	// so that logging in again doesn't clear the guessing of codes.
+	challenge, err := h.mfaChallenge(r.Context(), user.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if challenge != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, challenge)
+		return
+	}
+	if err := h.Lockout.Reset(req.Email); err != nil {
+		logger.Log.Error("login lockout reset failed", zap.Error(err))
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+	tokens, err := h.startSession(r, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// Refresh godoc
+// @Summary      Refresh tokens
+// @Description  Exchanges a refresh token for a new access token and a new refresh token.
+// @Description  Every refresh token can be used once. Presenting one again revokes its session,
+// @Description  as either copy may be in the wrong hands.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body      models.RefreshRequest  true  "Refresh token"
+// @Success      200  {object}  models.TokenResponse
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "invalid refresh token"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/refresh [post]
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	current, err := h.Tokens.Rotate(r.Context(), auth.HashToken(req.RefreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRefreshTokenReused):
+			logger.Log.Warn("refresh token reused, revoking its session", zap.Int("user_id", current.UserID))
+			revoked, err := h.Sessions.RevokeFamily(r.Context(), current.FamilyID)
+			if err == nil {
+				err = denySessions(h.Denylist, revoked)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		case errors.Is(err, store.ErrRefreshTokenInvalid), errors.Is(err, pgx.ErrNoRows):
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	session, err := h.Sessions.Touch(r.Context(), current.FamilyID, r.UserAgent(), clientIP(r))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tokens, err := h.issueTokens(r.Context(), session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary      Logout
+// @Description  Signs out the session of the access token: the token and the refresh tokens of
+// @Description  the session stop working.
+// @Tags         auth
+// @Security 	 BearerAuth
+// @Success      204
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/logout [post]
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Denylist.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if claims.SessionID != 0 {
+		session, err := h.Sessions.Revoke(r.Context(), claims.UserID, claims.SessionID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err == nil {
+			if err := denySessions(h.Denylist, []*models.Session{session}); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startSession signs the user in on the device of the request.
+func (h *AuthHandler) startSession(r *http.Request, userID int) (*models.TokenResponse, error) {
+	familyID, err := auth.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	session := &models.Session{UserID: userID, FamilyID: familyID, UserAgent: r.UserAgent(), IP: clientIP(r)}
+	if err := h.Sessions.Create(r.Context(), session); err != nil {
+		return nil, err
+	}
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditLogin,
+		ActorID:    audit.Actor(userID),
+		TargetType: "user",
+		TargetID:   strconv.Itoa(userID),
+		After:      map[string]int{"session_id": session.ID},
+	})
+	return h.issueTokens(r.Context(), session)
+}
+
+// loginFailed counts and audits the failed login and reports lockouts it caused.
+func (h *AuthHandler) loginFailed(r *http.Request, email, ip string) {
+	metrics.LoginFailures.WithLabelValues("invalid_credentials").Inc()
+	audit.Record(r, models.AuditEvent{Action: models.AuditLoginFailed, TargetType: "email", TargetID: email})
+
+	locks, err := h.Lockout.Fail(email, ip)
+	if err != nil {
+		logger.Log.Error("login failure tracking failed", zap.Error(err))
+	}
+	for _, lock := range locks {
+		event := models.LoginLockout{Scope: lock.Scope, IP: ip}
+		if lock.Scope == models.LockoutAccount {
+			event.Email = email
+		}
+		h.reportLockout(r, lock, event)
+	}
+}
+
+// reportLockout counts, audits and publishes the lock if it's a lockout, i.e.
+// reached the longest delay. The event names whom it concerns.
+func (h *AuthHandler) reportLockout(r *http.Request, lock auth.Lock, event models.LoginLockout) {
+	if lock.Delay < h.Lockout.MaxDelay {
+		return
+	}
+	metrics.LoginLockouts.WithLabelValues(lock.Scope).Inc()
+	event.Failures = lock.Failures
+	event.Until = time.Now().Add(lock.Delay)
+
+	entry := models.AuditEvent{Action: models.AuditLockout, TargetType: "ip", TargetID: event.IP, After: event}
+	switch lock.Scope {
+	case models.LockoutAccount:
+		entry.TargetType, entry.TargetID = "email", event.Email
+	case models.LockoutMFA:
+		entry.TargetType, entry.TargetID = "user", strconv.Itoa(event.UserID)
+	}
+	audit.Record(r, entry)
+	logger.Log.Warn("login locked out", zap.String("scope", lock.Scope), zap.String("ip", event.IP),
+		zap.Int64("failures", lock.Failures), zap.Duration("for", lock.Delay))
+	if err := h.Broker.PublishEvent(queue.EventAuthLockout, event); err != nil {
+		logger.Log.Error("lockout event failed", zap.Error(err))
+	}
+}
+
+// issueTokens creates an access token and a refresh token of the session.
+func (h *AuthHandler) issueTokens(ctx context.Context, session *models.Session) (*models.TokenResponse, error) {
+	user, err := h.Store.Get(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	access, claims, err := auth.GenerateToken(session.UserID, session.ID, user.EmailVerifiedAt != nil)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := auth.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	accessExpiresAt := claims.ExpiresAt.Time
+	err = h.Tokens.Create(ctx, &models.RefreshToken{
+		UserID:          session.UserID,
+		FamilyID:        session.FamilyID,
+		AccessJTI:       claims.ID,
+		AccessExpiresAt: &accessExpiresAt,
+		ExpiresAt:       time.Now().Add(auth.RefreshTokenTTL),
+	}, auth.HashToken(refresh))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		Token:        access,
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
 }
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
+	"GoProjects/TaskTracker/internal/realtime"
+	"GoProjects/TaskTracker/internal/store"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+)
+
+type BoardHandler struct {
+	Tasks *store.TaskStore
+	Store *store.BoardStore
+	Hub   *realtime.Hub
+}
+
+func RegisterBoardRoutes(r chi.Router, tasks *store.TaskStore, s *store.BoardStore, hub *realtime.Hub) {
+	h := &BoardHandler{Tasks: tasks, Store: s, Hub: hub}
+
+	r.Get("/board", h.GetBoard)
+	r.Put("/board/columns/{status}", h.UpdateColumn)
+}
+
+// GetBoard godoc
+// @Summary      Get board
+// @Description  Returns the tasks of the authenticated user grouped into one column per status,
+// @Description  each ordered by rank, together with the WIP limits of the columns.
+// @Tags         board
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.Board
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /board [get]
+func (h *BoardHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tasks, err := h.Tasks.Board(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	limits, err := h.Store.WIPLimits(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	board := models.Board{Columns: make([]models.BoardColumn, len(models.TaskStatuses))}
+	index := make(map[string]int, len(models.TaskStatuses))
+	for i, status := range models.TaskStatuses {
+		board.Columns[i] = models.BoardColumn{Status: status, Tasks: []*models.Task{}}
+		if limit, ok := limits[status]; ok {
+			board.Columns[i].WIPLimit = &limit
+		}
+		index[status] = i
+	}
+	for _, t := range tasks {
+		i, ok := index[t.Status]
+		if !ok {
+			continue
+		}
+		board.Columns[i].Tasks = append(board.Columns[i].Tasks, t)
+		board.Columns[i].Count++
+	}
+	writeJSON(w, http.StatusOK, board)
+}
+
+// UpdateColumn godoc
+// @Summary      Update board column
+// @Description  Sets or removes (null) the WIP limit of a column. Lowering the limit below the
+// @Description  current number of tasks is allowed; it only blocks further tasks from entering.
+// @Tags         board
+// @Accept       json
+// @Produce      json
+// @Param        status  path      string                     true  "Column status"
+// @Param        column  body      models.BoardColumnRequest  true  "Column settings"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.BoardColumnRequest
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "unknown column"
+// @Failure      500  {string}  string "internal error"
+// @Router       /board/columns/{status} [put]
+func (h *BoardHandler) UpdateColumn(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status := chi.URLParam(r, "status")
+	if !models.IsValidStatus(status) {
+		http.Error(w, "unknown column", http.StatusNotFound)
+		return
+	}
+	var req models.BoardColumnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.WIPLimit != nil && *req.WIPLimit < 1 {
+		http.Error(w, "wip_limit must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Store.SetWIPLimit(r.Context(), userID, status, req.WIPLimit); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+	h.Hub.BroadcastTo(userID, realtime.Message{
+		Type: "board_column_updated",
+		Data: map[string]interface{}{"user_id": userID, "status": status, "wip_limit": req.WIPLimit},
+	})
+}
+
+// MoveTask godoc
+// @Summary      Move task on the board
+// @Description  Moves the task into the status column between before_id (the task above it) and
+// @Description  after_id (the task below it). With a single neighbor the task is placed right next
+// @Description  to it, with none at the bottom of the column. Status defaults to the current one.
+// @Tags         board
+// @Accept       json
+// @Produce      json
+// @Param        id        path    int                 true   "Task ID"
+// @Param        If-Match  header  string              false  "ETag of the task version being moved"
+// @Param        move      body    models.MoveRequest  true   "Target position"
+// @Param        Idempotency-Key  header  string  false  "Unique key to make retries safe"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.Task
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      409  {string}  string "WIP limit reached"
+// @Failure      412  {string}  string "task was modified"
+// @Failure      422  {string}  string "invalid neighbors"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/move [post]
+func (h *TaskHandler) MoveTask(w http.ResponseWriter, r *http.Request) {
+	current, ok := loadOwnedTask(w, r, h.Store)
+	if !ok {
+		return
+	}
+	expectedVersion := 0
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !taskIfMatch(ifMatch, current) {
+			http.Error(w, "task was modified", http.StatusPreconditionFailed)
+			return
+		}
+		expectedVersion = current.Version
+	}
+
+	var req models.MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Status == "" {
+		req.Status = current.Status
+	}
+	if !models.IsValidStatus(req.Status) {
+		http.Error(w, "unknown status "+strconv.Quote(req.Status), http.StatusBadRequest)
+		return
+	}
+
+	moved, err := h.Store.Move(r.Context(), current.UserID, current.ID, req.Status, req.BeforeID, req.AfterID, expectedVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrVersionConflict):
+			http.Error(w, "task was modified", http.StatusPreconditionFailed)
+		case errors.Is(err, store.ErrWIPLimit):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, store.ErrInvalidNeighbor):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, pgx.ErrNoRows):
+			http.Error(w, "task not found", http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(moved))
+	writeJSON(w, http.StatusOK, moved)
+
+	h.Hub.BroadcastTo(moved.UserID, realtime.Message{
+		Type: "task_moved",
+		Data: models.TaskMoved{Task: moved, BeforeID: req.BeforeID, AfterID: req.AfterID},
+	})
+	h.publish(queue.EventTaskMoved, moved)
+	auditTask(r, models.AuditTaskUpdated, current, moved)
+	_ = h.Cache.DeleteMany("tasks:user:"+strconv.Itoa(moved.UserID), "task:"+strconv.Itoa(moved.ID))
+}
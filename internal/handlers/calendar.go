@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/ical"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/store"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type CalendarHandler struct {
+	Store *store.CalendarStore
+	Tasks *store.TaskStore
+}
+
+// CalendarToken is returned once when a feed token is created. Only its hash is stored.
+type CalendarToken struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// RegisterCalendarFeedRoutes registers the feed itself. It is authenticated by
+// the secret token in the URL, because calendar clients can't send a JWT.
+func RegisterCalendarFeedRoutes(r chi.Router, cs *store.CalendarStore, ts *store.TaskStore) {
+	h := &CalendarHandler{Store: cs, Tasks: ts}
+	r.Get("/calendar/{token}.ics", h.GetFeed)
+}
+
+// RegisterCalendarRoutes registers feed token management for authenticated users.
+func RegisterCalendarRoutes(r chi.Router, cs *store.CalendarStore, ts *store.TaskStore) {
+	h := &CalendarHandler{Store: cs, Tasks: ts}
+	r.Post("/calendar/token", h.CreateToken)
+	r.Delete("/calendar/token", h.DeleteToken)
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetFeed godoc
+// @Summary      Calendar feed
+// @Description  iCalendar feed of the owner's tasks that have a due date. Tasks are rendered as
+// @Description  VEVENT entries, or as VTODO entries with type=todo. Subscribe to this URL from a
+// @Description  calendar client; it always reflects the current state of the tasks.
+// @Tags         calendar
+// @Produce      text/calendar
+// @Param        token          path    string  true   "Feed token"
+// @Param        type           query   string  false  "event (default) or todo"
+// @Param        If-None-Match  header  string  false  "ETag of a previously fetched feed"
+// @Success      200  {string}  string "iCalendar document"
+// @Success      304  {string}  string "not modified"
+// @Failure      400  {string}  string "invalid type"
+// @Failure      404  {string}  string "feed not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /calendar/{token}.ics [get]
+func (h *CalendarHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	component := ical.Event
+	switch r.URL.Query().Get("type") {
+	case "", "event":
+	case "todo":
+		component = ical.Todo
+	default:
+		http.Error(w, "type must be event or todo", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.Store.UserByToken(r.Context(), hashCalendarToken(chi.URLParam(r, "token")))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "feed not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cal := &ical.Calendar{Name: "Tasks", Component: component}
+	err = h.Tasks.Stream(r.Context(), store.TaskFilter{UserID: userID, DueOnly: true}, func(t *models.Task) error {
+		cal.Items = append(cal.Items, calendarItem(t, component))
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// DTSTAMP is pinned to the latest change so that an unchanged feed renders
+	// byte for byte the same and can be answered with 304.
+	var stamp time.Time
+	for _, it := range cal.Items {
+		if it.Modified.After(stamp) {
+			stamp = it.Modified
+		}
+	}
+	var buf bytes.Buffer
+	if err := cal.Write(&buf, stamp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := bodyETag(buf.Bytes())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func calendarItem(t *models.Task, component ical.Component) ical.Item {
+	it := ical.Item{
+		UID:         "task-" + strconv.Itoa(t.ID) + "@tasktracker",
+		Summary:     t.Title,
+		Description: t.Description,
+		Due:         *t.DueAt,
+		Sequence:    t.Version - 1,
+		Created:     t.CreatedAt,
+		Modified:    t.UpdatedAt,
+	}
+	if component == ical.Event {
+		it.Status = ical.StatusConfirmed
+		return it
+	}
+	switch t.Status {
+	case models.StatusInProgress:
+		it.Status = ical.StatusInProcess
+	case models.StatusDone:
+		it.Status = ical.StatusCompleted
+		it.Completed = &t.UpdatedAt
+	default:
+		it.Status = ical.StatusNeedsAction
+	}
+	return it
+}
+
+// CreateToken godoc
+// @Summary      Create calendar feed token
+// @Description  Creates a secret URL for the calendar feed. Creating a new token revokes the previous one.
+// @Description  The token is only returned once.
+// @Tags         calendar
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      201  {object}  CalendarToken
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /calendar/token [post]
+func (h *CalendarHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(raw)
+	if err := h.Store.SetToken(r.Context(), userID, hashCalendarToken(token)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	writeJSON(w, http.StatusCreated, CalendarToken{
+		Token: token,
+		URL:   scheme + "://" + r.Host + "/calendar/" + token + ".ics",
+	})
+}
+
+// DeleteToken godoc
+// @Summary      Revoke calendar feed token
+// @Description  Disables the calendar feed
+// @Tags         calendar
+// @Security 	 BearerAuth
+// @Success      204  {string}  string "no content"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "feed not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /calendar/token [delete]
+func (h *CalendarHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Store.DeleteToken(r.Context(), userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "feed not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/cache"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/realtime"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+type ChecklistHandler struct {
+	Tasks *store.TaskStore
+	Store *store.ChecklistStore
+	Hub   *realtime.Hub
+	Cache *cache.RedisCache
+}
+
+func RegisterChecklistRoutes(r chi.Router, tasks *store.TaskStore, s *store.ChecklistStore, hub *realtime.Hub, cache *cache.RedisCache) {
+	h := &ChecklistHandler{Tasks: tasks, Store: s, Hub: hub, Cache: cache}
+
+	r.Route("/tasks/{id}/checklist", func(r chi.Router) {
+		r.Get("/", h.ListItems)
+		r.Post("/", h.AddItem)
+		r.Put("/order", h.ReorderItems)
+		r.Patch("/{itemID}", h.UpdateItem)
+		r.Delete("/{itemID}", h.DeleteItem)
+	})
+}
+
+func parseItemID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "itemID"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// checklistChanged sends the change with the new progress of the task to the
+// clients of its owner and drops the cached copies of the task, whose progress
+// is now stale.
+func (h *ChecklistHandler) checklistChanged(ctx context.Context, eventType string, task *models.Task, change models.ChecklistChange) {
+	progress, err := h.Store.Progress(ctx, task.ID)
+	if err != nil {
+		logger.Log.Error("checklist progress error", zap.Error(err))
+	}
+	change.TaskID = task.ID
+	change.Progress = progress
+	h.Hub.BroadcastTo(task.UserID, realtime.Message{Type: eventType, Data: change})
+
+	_ = h.Cache.DeleteMany("tasks:user:"+strconv.Itoa(task.UserID), "task:"+strconv.Itoa(task.ID))
+}
+
+// ListItems godoc
+// @Summary      List checklist items
+// @Tags         checklist
+// @Produce      json
+// @Param        id   path      int  true  "Task ID"
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.ChecklistItem
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/checklist [get]
+func (h *ChecklistHandler) ListItems(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+	items, err := h.Store.List(r.Context(), task.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// AddItem godoc
+// @Summary      Add checklist item
+// @Description  Appends an item to the checklist, or inserts it at position.
+// @Tags         checklist
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                          true  "Task ID"
+// @Param        item  body      models.ChecklistItemRequest  true  "Item"
+// @Security 	 BearerAuth
+// @Success      201  {object}  models.ChecklistItem
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      409  {string}  string "checklist is full"
+// @Failure      422  {object}  map[string][]models.FieldError
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/checklist [post]
+func (h *ChecklistHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+
+	var req models.ChecklistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	errs := req.Validate()
+	if req.Text == nil {
+		errs = append(errs, models.FieldError{Field: "text", Message: "is required"})
+	}
+	if req.Checked != nil {
+		errs = append(errs, models.FieldError{Field: "checked", Message: "can't be set on a new item"})
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string][]models.FieldError{"errors": errs})
+		return
+	}
+
+	item, err := h.Store.Add(r.Context(), task.ID, *req.Text, req.Position)
+	if err != nil {
+		if errors.Is(err, store.ErrChecklistFull) {
+			http.Error(w, "checklist is full", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, item)
+	h.checklistChanged(r.Context(), "checklist_item_added", task, models.ChecklistChange{Item: item})
+}
+
+// UpdateItem godoc
+// @Summary      Update checklist item
+// @Description  Edits the text, checks or unchecks the item, or moves it to another position.
+// @Tags         checklist
+// @Accept       json
+// @Produce      json
+// @Param        id      path      int                          true  "Task ID"
+// @Param        itemID  path      int                          true  "Item ID"
+// @Param        item    body      models.ChecklistItemRequest  true  "Fields to change"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.ChecklistItem
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "item not found"
+// @Failure      422  {object}  map[string][]models.FieldError
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/checklist/{itemID} [patch]
+func (h *ChecklistHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+	id, ok := parseItemID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ChecklistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errs := req.Validate(); len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string][]models.FieldError{"errors": errs})
+		return
+	}
+
+	item, err := h.Store.Update(r.Context(), task.ID, id, req)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "item not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+	h.checklistChanged(r.Context(), "checklist_item_updated", task, models.ChecklistChange{Item: item})
+}
+
+// ReorderItems godoc
+// @Summary      Reorder checklist
+// @Description  Sets the order of the whole checklist. ids must list every item of the task exactly once.
+// @Tags         checklist
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                    true  "Task ID"
+// @Param        order  body      models.ChecklistOrder  true  "Item ids in their new order"
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.ChecklistItem
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      422  {string}  string "ids must list every checklist item exactly once"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/checklist/order [put]
+func (h *ChecklistHandler) ReorderItems(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+
+	var order models.ChecklistOrder
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, err := h.Store.Reorder(r.Context(), task.ID, order.IDs)
+	if err != nil {
+		if errors.Is(err, store.ErrChecklistOrder) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+	h.checklistChanged(r.Context(), "checklist_reordered", task, models.ChecklistChange{Items: items})
+}
+
+// DeleteItem godoc
+// @Summary      Delete checklist item
+// @Tags         checklist
+// @Param        id      path  int  true  "Task ID"
+// @Param        itemID  path  int  true  "Item ID"
+// @Security 	 BearerAuth
+// @Success      204  {string}  string "no content"
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "item not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/checklist/{itemID} [delete]
+func (h *ChecklistHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+	id, ok := parseItemID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Store.Delete(r.Context(), task.ID, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "item not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	h.checklistChanged(r.Context(), "checklist_item_deleted", task, models.ChecklistChange{Item: &models.ChecklistItem{ID: id, TaskID: task.ID}})
+}
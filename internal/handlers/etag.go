@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// taskETag derives the entity tag of a single task from its version and its
+// checklist progress, which changes without bumping the version.
+func taskETag(t *models.Task) string {
+	return fmt.Sprintf(`"%d.%d.%d"`, t.Version, t.Checklist.Done, t.Checklist.Total)
+}
+
+// taskIfMatch reports whether an If-Match header value matches the task. Only the
+// version part of the tag is compared: checking off a checklist item must not make
+// a concurrent edit of the task itself fail.
+func taskIfMatch(header string, t *models.Task) bool {
+	version := strconv.Itoa(t.Version)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		candidate = strings.Trim(strings.TrimPrefix(candidate, "W/"), `"`)
+		if v, _, _ := strings.Cut(candidate, "."); v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyETag derives the entity tag of a collection from its serialized body.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether a If-Match / If-None-Match header value matches etag.
+// The weak indicator is ignored since all our tags are derived from content.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
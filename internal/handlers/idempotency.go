@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/cache"
+	"GoProjects/TaskTracker/internal/logger"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLockTTL bounds how long a crashed request keeps its key locked.
+	idempotencyLockTTL = time.Minute
+	maxIdempotencyKey  = 255
+)
+
+// replayedHeaders are the response headers stored and replayed with the body.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotentRecord is what is stored under an Idempotency-Key.
+// Status is 0 while the first request is still being processed.
+type idempotentRecord struct {
+	Fingerprint string            `json:"fingerprint"`
+	Status      int               `json:"status"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+}
+
+// captureWriter passes the response through while keeping a copy of it.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+// Idempotency makes mutating endpoints safe to retry. The response to the first
+// request carrying an Idempotency-Key header is stored in Redis and replayed for
+// repeats with the same key. Reusing a key for a different request is rejected
+// with 422. Keys are scoped to the authenticated user; server errors aren't stored
+// so the request can be retried.
+func Idempotency(c *cache.RedisCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			userID, ok := r.Context().Value("userID").(int)
+			if key == "" || !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKey {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 8<<20))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			fingerprint := requestFingerprint(r, body)
+			cacheKey := "idempotency:" + strconv.Itoa(userID) + ":" + key
+
+			pending, _ := json.Marshal(idempotentRecord{Fingerprint: fingerprint})
+			acquired, err := c.SetNX(cacheKey, string(pending), idempotencyLockTTL)
+			if err != nil {
+				logger.Log.Warn("idempotency store unavailable", zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !acquired {
+				replayIdempotent(w, c, cacheKey, fingerprint)
+				return
+			}
+
+			cw := &captureWriter{ResponseWriter: w}
+			next.ServeHTTP(cw, r)
+
+			if cw.status == 0 || cw.status >= http.StatusInternalServerError {
+				_ = c.Delete(cacheKey)
+				return
+			}
+
+			rec := idempotentRecord{
+				Fingerprint: fingerprint,
+				Status:      cw.status,
+				Header:      make(map[string]string),
+				Body:        cw.body.Bytes(),
+			}
+			for _, name := range replayedHeaders {
+				if v := w.Header().Get(name); v != "" {
+					rec.Header[name] = v
+				}
+			}
+			data, err := json.Marshal(rec)
+			if err != nil {
+				_ = c.Delete(cacheKey)
+				return
+			}
+			if err := c.Set(cacheKey, string(data), idempotencyTTL); err != nil {
+				logger.Log.Warn("idempotency record not saved", zap.Error(err))
+			}
+		})
+	}
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + r.Header.Get("If-Match") + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replayIdempotent(w http.ResponseWriter, c *cache.RedisCache, cacheKey, fingerprint string) {
+	stored, err := c.Get(cacheKey)
+	if err != nil {
+		// The key expired or the first request failed in between.
+		http.Error(w, "request with this Idempotency-Key is being processed, retry", http.StatusConflict)
+		return
+	}
+
+	var rec idempotentRecord
+	if err := json.Unmarshal([]byte(stored), &rec); err != nil {
+		http.Error(w, "corrupted idempotency record", http.StatusInternalServerError)
+		return
+	}
+	if rec.Fingerprint != fingerprint {
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if rec.Status == 0 {
+		http.Error(w, "request with this Idempotency-Key is being processed, retry", http.StatusConflict)
+		return
+	}
+
+	for name, v := range rec.Header {
+		w.Header().Set(name, v)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/importer"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
+	"GoProjects/TaskTracker/internal/store"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxImportSize = 10 << 20
+
+type ImportHandler struct {
+	Store  *store.ImportStore
+	Broker *queue.Broker
+}
+
+func RegisterImportRoutes(r chi.Router, s *store.ImportStore, broker *queue.Broker) {
+	h := &ImportHandler{Store: s, Broker: broker}
+
+	r.Route("/imports", func(r chi.Router) {
+		r.Post("/", h.CreateImport)
+		r.Get("/{id}", h.GetImport)
+	})
+}
+
+// CreateImport godoc
+// @Summary      Import tasks
+// @Description  Uploads a file exported from another tracker. The import runs in the background;
+// @Description  poll GetImport for progress and per-row errors. Imported tasks are announced over
+// @Description  the WebSocket as a tasks_batch every 100 rows. Supported formats are csv,
+// @Description  jira_csv and trello_json. The optional mapping maps CSV column names (or Trello
+// @Description  list names) to task fields (or statuses).
+// @Tags         imports
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file     formData  file    true   "File to import, up to 10 MB"
+// @Param        format   formData  string  true   "csv, jira_csv or trello_json"
+// @Param        mapping  formData  string  false  "JSON object, e.g. {\"Name\": \"title\"}"
+// @Security 	 BearerAuth
+// @Success      202  {object}  models.Import
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      413  {string}  string "file too large"
+// @Failure      500  {string}  string "internal error"
+// @Router       /imports [post]
+func (h *ImportHandler) CreateImport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+1<<20)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.FormValue("format")
+	if _, ok := importer.Get(format); !ok {
+		http.Error(w, "format must be one of "+strings.Join(importer.Formats(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	var mapping map[string]string
+	if raw := r.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			http.Error(w, "mapping must be a JSON object of strings", http.StatusBadRequest)
+			return
+		}
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(file, maxImportSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(payload) > maxImportSize {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	imp := &models.Import{UserID: userID, Format: format, Filename: header.Filename, Mapping: mapping}
+	if err := h.Store.Create(r.Context(), imp, payload); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Broker.PublishEvent(queue.EventImportRequested, map[string]int{"import_id": imp.ID}); err != nil {
+		logger.Log.Error("Publish error", zap.Error(err))
+		http.Error(w, "could not schedule import", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/imports/"+strconv.Itoa(imp.ID))
+	writeJSON(w, http.StatusAccepted, imp)
+}
+
+// GetImport godoc
+// @Summary      Get import
+// @Description  Returns status, progress and per-row errors of an import
+// @Tags         imports
+// @Produce      json
+// @Param        id   path      int  true  "Import ID"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.Import
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "import not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /imports/{id} [get]
+func (h *ImportHandler) GetImport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	imp, err := h.Store.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "import not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if imp.UserID != userID {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, imp)
+}
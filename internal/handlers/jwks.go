@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/auth"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+type JWKSHandler struct {
+	Keys *auth.KeySet
+}
+
+func RegisterJWKSRoutes(r chi.Router, keys *auth.KeySet) {
+	h := &JWKSHandler{Keys: keys}
+
+	r.Get("/.well-known/jwks.json", h.GetJWKS)
+}
+
+// GetJWKS godoc
+// @Summary      JSON Web Key Set
+// @Description  Returns the public keys that verify access tokens, selected by the kid header of a
+// @Description  token. New keys are listed a while before they start signing, so caching the set
+// @Description  for the advertised time is safe.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  models.JSONWebKeySet
+// @Router       /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, h.Keys.JWKS())
+}
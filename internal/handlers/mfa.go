@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/auth"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/metrics"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mfaIssuer         = "TaskTracker"
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaMaxAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+var errMFAChallenge = errors.New("invalid or expired mfa_token")
+
+// mfaPending is the login an MFA token stands for.
+type mfaPending struct {
+	UserID int  `json:"user_id"`
+	Enroll bool `json:"enroll"`
+}
+
+func mfaChallengeKey(token string) string {
+	return "mfa:challenge:" + auth.HashToken(token)
+}
+
+// mfaRequired tells whether everybody needs 2FA, by MFA_REQUIRED or because
+// admins require it for the workspace.
+func (h *AuthHandler) mfaRequired(ctx context.Context) (bool, error) {
+	if h.MFARequired {
+		return true, nil
+	}
+	settings, err := h.Settings.Get(ctx)
+	if err != nil {
+		return false, err
+	}
+	return settings.MFARequired, nil
+}
+
+// mfaChallenge returns the challenge that has to be completed before the user
+// gets tokens, or nil when the password is enough.
+func (h *AuthHandler) mfaChallenge(ctx context.Context, userID int) (*models.MFAChallenge, error) {
+	m, err := h.MFA.Get(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	enabled := err == nil && m.EnabledAt != nil
+	if !enabled {
+		required, err := h.mfaRequired(ctx)
+		if err != nil || !required {
+			return nil, err
+		}
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(mfaPending{UserID: userID, Enroll: !enabled})
+	if err := h.Cache.Set(mfaChallengeKey(token), string(data), mfaChallengeTTL); err != nil {
+		return nil, err
+	}
+	return &models.MFAChallenge{
+		MFARequired:        true,
+		EnrollmentRequired: !enabled,
+		MFAToken:           token,
+		ExpiresIn:          int(mfaChallengeTTL.Seconds()),
+	}, nil
+}
+
+// pendingMFA returns the login of the MFA token and counts an attempt on it.
+// After mfaMaxAttempts the token is dropped, so codes can't be guessed.
+func (h *AuthHandler) pendingMFA(token string) (*mfaPending, error) {
+	if token == "" {
+		return nil, errMFAChallenge
+	}
+	key := mfaChallengeKey(token)
+	attempts, err := h.Cache.Incr(key+":attempts", mfaChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if attempts > mfaMaxAttempts {
+		_ = h.Cache.Delete(key)
+		return nil, errMFAChallenge
+	}
+
+	data, err := h.Cache.Get(key)
+	if err != nil {
+		return nil, errMFAChallenge
+	}
+	var pending mfaPending
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		return nil, errMFAChallenge
+	}
+	return &pending, nil
+}
+
+// completeMFA spends the MFA token and signs the user in. Of concurrent
+// requests with the same token only one gets through. The failed logins of the
+// account are forgotten only here, once both factors checked out.
+func (h *AuthHandler) completeMFA(r *http.Request, token string, userID int) (*models.TokenResponse, error) {
+	if _, err := h.Cache.Take(mfaChallengeKey(token)); err != nil {
+		return nil, errMFAChallenge
+	}
+	user, err := h.Store.Get(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Lockout.Reset(user.Email); err != nil {
+		logger.Log.Error("login lockout reset failed", zap.Error(err))
+	}
+	if err := h.Lockout.ResetMFA(userID); err != nil {
+		logger.Log.Error("mfa lockout reset failed", zap.Error(err))
+	}
+	return h.startSession(r, userID)
+}
+
+// mfaLocked answers 429 and reports true while wrong codes keep the second
+// factor of the user locked.
+func (h *AuthHandler) mfaLocked(w http.ResponseWriter, userID int) bool {
+	wait, err := h.Lockout.CheckMFA(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	if wait > 0 {
+		metrics.LoginFailures.WithLabelValues("locked").Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many wrong codes, try again later", http.StatusTooManyRequests)
+		return true
+	}
+	return false
+}
+
+// mfaFailed audits the wrong code as a failed login, counts it against the
+// user, however many MFA tokens it's spread over, and reports lockouts it caused.
+func (h *AuthHandler) mfaFailed(r *http.Request, userID int) {
+	metrics.LoginFailures.WithLabelValues("invalid_mfa_code").Inc()
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditLoginFailed,
+		ActorID:    audit.Actor(userID),
+		TargetType: "user",
+		TargetID:   strconv.Itoa(userID),
+		After:      map[string]string{"reason": "invalid_mfa_code"},
+	})
+	lock, err := h.Lockout.FailMFA(userID)
+	if err != nil {
+		logger.Log.Error("mfa failure tracking failed", zap.Error(err))
+	}
+	if lock != nil {
+		h.reportLockout(r, *lock, models.LoginLockout{Scope: lock.Scope, UserID: userID, IP: clientIP(r)})
+	}
+}
+
+// checkTOTP validates the code against the user's secret and makes sure it
+// wasn't accepted before.
+func (h *AuthHandler) checkTOTP(ctx context.Context, m *models.MFA, code string) (bool, error) {
+	counter, ok := auth.ValidateTOTP(m.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return h.MFA.UseCounter(ctx, m.UserID, counter)
+}
+
+// VerifyMFA godoc
+// @Summary      Complete login with a second factor
+// @Description  Exchanges the mfa_token returned by /auth/login and a current TOTP code (or an
+// @Description  unused recovery code) for tokens. An mfa_token allows 5 attempts. Wrong codes
+// @Description  also lock the second factor of the account for increasing periods, however
+// @Description  many logins they are spread over, answered with 429 and Retry-After.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        verification  body      models.MFAVerifyRequest  true  "MFA token and code"
+// @Success      200  {object}  models.TokenResponse
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "invalid code"
+// @Failure      429  {string}  string "too many wrong codes, see Retry-After"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/mfa/verify [post]
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		http.Error(w, "either code or recovery_code is required", http.StatusBadRequest)
+		return
+	}
+
+	pending, err := h.pendingMFA(req.MFAToken)
+	if errors.Is(err, errMFAChallenge) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pending.Enroll {
+		http.Error(w, "two-factor authentication must be set up first, see /auth/mfa/enroll", http.StatusBadRequest)
+		return
+	}
+	if h.mfaLocked(w, pending.UserID) {
+		return
+	}
+
+	m, err := h.MFA.Get(r.Context(), pending.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var valid bool
+	if req.RecoveryCode != "" {
+		valid, err = h.MFA.UseRecoveryCode(r.Context(), pending.UserID, auth.HashRecoveryCode(req.RecoveryCode))
+		if valid {
+			logger.Log.Info("mfa recovery code used", zap.Int("user_id", pending.UserID))
+		}
+	} else {
+		valid, err = h.checkTOTP(r.Context(), m, req.Code)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		h.mfaFailed(r, pending.UserID)
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.completeMFA(r, req.MFAToken, pending.UserID)
+	if errors.Is(err, errMFAChallenge) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// enrollingUser returns the user setting up 2FA: the one of the access token
+// or, during a login that requires enrollment, the one of the MFA token.
+func (h *AuthHandler) enrollingUser(r *http.Request, mfaToken string) (int, *mfaPending, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		claims, err := auth.ParseToken(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			return 0, nil, errMFAChallenge
+		}
+		return claims.UserID, nil, nil
+	}
+	pending, err := h.pendingMFA(mfaToken)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !pending.Enroll {
+		return 0, nil, errMFAChallenge
+	}
+	return pending.UserID, pending, nil
+}
+
+// EnrollMFA godoc
+// @Summary      Start 2FA enrollment
+// @Description  Generates a TOTP secret and the otpauth URI to show as a QR code. Authenticate
+// @Description  with a bearer token, or with the mfa_token of a login requiring enrollment. The
+// @Description  enrollment completes at /auth/mfa/enable with a first code.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        enrollment  body      models.MFAEnrollRequest  false  "MFA token"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.MFAEnrollment
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      409  {string}  string "already enabled"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/mfa/enroll [post]
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFAEnrollRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	userID, _, err := h.enrollingUser(r, req.MFAToken)
+	if errors.Is(err, errMFAChallenge) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := h.Store.Get(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.MFA.Begin(r.Context(), userID, secret); err != nil {
+		if errors.Is(err, store.ErrMFAEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, models.MFAEnrollment{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(mfaIssuer, user.Email, secret),
+	})
+}
+
+// EnableMFA godoc
+// @Summary      Finish 2FA enrollment
+// @Description  Turns on two-factor authentication once a first code from the authenticator app
+// @Description  checks out, and returns recovery codes, shown only this once. When the enrollment
+// @Description  was part of a login, the login completes and its tokens are returned too.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        code  body      models.MFAEnableRequest  true  "First code"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.MFAEnabled
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      409  {string}  string "already enabled"
+// @Failure      422  {string}  string "invalid code"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/mfa/enable [post]
+func (h *AuthHandler) EnableMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFAEnableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, pending, err := h.enrollingUser(r, req.MFAToken)
+	if errors.Is(err, errMFAChallenge) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m, err := h.MFA.Get(r.Context(), userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "no enrollment in progress, see /auth/mfa/enroll", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if m.EnabledAt != nil {
+		http.Error(w, store.ErrMFAEnabled.Error(), http.StatusConflict)
+		return
+	}
+	counter, ok := auth.ValidateTOTP(m.Secret, req.Code, time.Now())
+	if !ok {
+		http.Error(w, "invalid code", http.StatusUnprocessableEntity)
+		return
+	}
+
+	codes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = auth.HashRecoveryCode(c)
+	}
+	if err := h.MFA.Enable(r.Context(), userID, counter, hashes); err != nil {
+		if errors.Is(err, store.ErrMFAEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("mfa enabled", zap.Int("user_id", userID))
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditMFAEnabled,
+		ActorID:    audit.Actor(userID),
+		TargetType: "user",
+		TargetID:   strconv.Itoa(userID),
+	})
+
+	resp := models.MFAEnabled{RecoveryCodes: codes}
+	if pending != nil {
+		resp.Tokens, err = h.completeMFA(r, req.MFAToken, userID)
+		if err != nil && !errors.Is(err, errMFAChallenge) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetMFA godoc
+// @Summary      2FA status
+// @Description  Tells whether two-factor authentication is on and how many recovery codes are left.
+// @Tags         mfa
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.MFAStatus
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/mfa [get]
+func (h *AuthHandler) GetMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	required, err := h.mfaRequired(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	status := models.MFAStatus{Required: required}
+	m, err := h.MFA.Get(r.Context(), userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil && m.EnabledAt != nil {
+		status.Enabled = true
+		if status.RecoveryCodesLeft, err = h.MFA.RecoveryCodesLeft(r.Context(), userID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// DisableMFA godoc
+// @Summary      Turn off 2FA
+// @Description  Removes the TOTP secret and the recovery codes. Requires a current code, and is
+// @Description  refused while two-factor authentication is required for everybody. Wrong codes
+// @Description  count towards the same lock as at /auth/mfa/verify.
+// @Tags         mfa
+// @Accept       json
+// @Param        code  body      models.MFADisableRequest  true  "Current code"
+// @Security 	 BearerAuth
+// @Success      204
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "two-factor authentication is required"
+// @Failure      404  {string}  string "not enabled"
+// @Failure      422  {string}  string "invalid code"
+// @Failure      429  {string}  string "too many wrong codes, see Retry-After"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/mfa [delete]
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	required, err := h.mfaRequired(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if required {
+		http.Error(w, "two-factor authentication is required", http.StatusForbidden)
+		return
+	}
+	var req models.MFADisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m, err := h.MFA.Get(r.Context(), userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && m.EnabledAt == nil) {
+		http.Error(w, "two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// A stolen access token mustn't be enough to guess the code.
+	if h.mfaLocked(w, userID) {
+		return
+	}
+	valid, err := h.checkTOTP(r.Context(), m, req.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		h.mfaFailed(r, userID)
+		http.Error(w, "invalid code", http.StatusUnprocessableEntity)
+		return
+	}
+	if err := h.Lockout.ResetMFA(userID); err != nil {
+		logger.Log.Error("mfa lockout reset failed", zap.Error(err))
+	}
+
+	if err := h.MFA.Disable(r.Context(), userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("mfa disabled", zap.Int("user_id", userID))
+	audit.Record(r, models.AuditEvent{Action: models.AuditMFADisabled, TargetType: "user", TargetID: strconv.Itoa(userID)})
+	w.WriteHeader(http.StatusNoContent)
+}
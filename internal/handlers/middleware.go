@@ -4,10 +4,14 @@ import (
 	"GoProjects/TaskTracker/internal/auth"
 	"GoProjects/TaskTracker/internal/logger"
 	"GoProjects/TaskTracker/internal/metrics"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/store"
 	"context"
+	"errors"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 )
@@ -27,6 +31,36 @@ func (rw *responseWriter) WriteHeader(status int) {
 	rw.wroteHeader = true
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// RequestID gives every request an id ("requestID" in the context), taken from
+// a sane X-Request-ID header or generated, and returns it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id, _ = auth.RandomToken(12)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "requestID", id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/ws" || websocket.IsWebSocketUpgrade(r) || strings.HasPrefix(r.URL.Path, "/swagger") ||
@@ -46,7 +80,9 @@ func Logger(next http.Handler) http.Handler {
 		method := r.Method
 		status := rw.status
 
+		requestID, _ := r.Context().Value("requestID").(string)
 		logger.Log.Info("HTTP request",
+			zap.String("request_id", requestID),
 			zap.String("method", method),
 			zap.String("path", path),
 			zap.Int("status", status),
@@ -58,6 +94,9 @@ func Logger(next http.Handler) http.Handler {
 	})
 }
 
+// AuthMiddleware puts the user id ("userID") of authenticated requests into the
+// context, together with the token claims ("claims") of a JWT or the personal
+// access token ("accessToken").
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if websocket.IsWebSocketUpgrade(r) {
@@ -77,13 +116,109 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		userID, err := auth.ParseToken(parts[1])
+		if auth.IsAccessToken(parts[1]) {
+			token, err := auth.ParseAccessToken(r.Context(), parts[1])
+			if errors.Is(err, auth.ErrAccessTokenInvalid) {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), "userID", token.UserID)
+			ctx = context.WithValue(ctx, "accessToken", token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		claims, err := auth.ParseToken(parts[1])
+		if errors.Is(err, auth.ErrRevocationUnknown) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		if err != nil {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "userID", userID)
+		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
+		ctx = context.WithValue(ctx, "claims", claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequireVerifiedEmail lets only users with a confirmed email address through.
+// It goes after AuthMiddleware.
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := r.Context().Value("claims").(*auth.Claims); ok && claims.EmailUnverified {
+			http.Error(w, "email address not verified", http.StatusForbidden)
+			return
+		}
+		// Personal access tokens outlive email changes; their owner is looked up
+		// on every request.
+		if token, ok := r.Context().Value("accessToken").(*models.AccessToken); ok && token.EmailUnverified {
+			http.Error(w, "email address not verified", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope lets personal access tokens through only with the read scope for
+// GET and HEAD requests and the write scope for all others. Requests with a JWT
+// act with the full rights of the user. It goes after AuthMiddleware.
+func RequireScope(read, write string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := r.Context().Value("accessToken").(*models.AccessToken); ok {
+				scope := write
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					scope = read
+				}
+				if !slices.Contains(token.Scopes, scope) {
+					http.Error(w, "token lacks the "+scope+" scope", http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectAccessTokens keeps personal access tokens away from managing the
+// account and its sign-in, which takes a login. It goes after AuthMiddleware.
+func RejectAccessTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("accessToken").(*models.AccessToken); ok {
+			http.Error(w, "personal access tokens can't be used here", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin lets only users with the admin role through. It goes after
+// AuthMiddleware.
+func RequireAdmin(users *store.UserStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value("userID").(int)
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			user, err := users.Get(r.Context(), userID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if user.Role != models.RoleAdmin {
+				http.Error(w, "admin role required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
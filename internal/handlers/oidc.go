@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/cache"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/metrics"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/oidc"
+	"GoProjects/TaskTracker/internal/store"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+type OIDCHandler struct {
+	Auth       *AuthHandler
+	Provider   *oidc.Provider
+	Identities *store.IdentityStore
+	Cache      *cache.RedisCache
+}
+
+// oidcLogin is kept between the redirect to the provider and the callback.
+type oidcLogin struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func RegisterOIDCRoutes(r chi.Router, authHandler *AuthHandler, provider *oidc.Provider, identities *store.IdentityStore, c *cache.RedisCache) {
+	h := &OIDCHandler{Auth: authHandler, Provider: provider, Identities: identities, Cache: c}
+
+	r.Get("/auth/oidc/login", h.Login)
+	r.Get("/auth/oidc/callback", h.Callback)
+}
+
+// Login godoc
+// @Summary      Single sign-on
+// @Description  Redirects to the identity provider to sign in with OpenID Connect (authorization
+// @Description  code flow with PKCE). The provider sends the user back to /auth/oidc/callback.
+// @Tags         auth
+// @Success      302
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/oidc/login [get]
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	state, err := oidc.NewState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, _ := json.Marshal(oidcLogin{Nonce: nonce, Verifier: verifier})
+	if err := h.Cache.Set("oidc:state:"+state, string(data), oidcStateTTL); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The cookie ties the callback to the browser that started the login, so
+	// nobody can sign a victim into the attacker's account.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.Provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// Callback godoc
+// @Summary      Single sign-on callback
+// @Description  Completes the sign-in at the identity provider. Users are matched by the provider
+// @Description  account, then by verified email; unknown users get a new account. Answers like
+// @Description  /auth/login: tokens, or a models.MFAChallenge for users with two-factor
+// @Description  authentication.
+// @Tags         auth
+// @Produce      json
+// @Param        code   query     string  true  "Authorization code"
+// @Param        state  query     string  true  "State of the login"
+// @Success      200  {object}  models.TokenResponse
+// @Failure      400  {string}  string "invalid login state"
+// @Failure      401  {string}  string "sign-in failed"
+// @Failure      403  {string}  string "email not verified"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/oidc/callback [get]
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		h.loginFailed(r, "oidc_"+errCode, "", "")
+		http.Error(w, "sign-in failed: "+errCode+" "+q.Get("error_description"), http.StatusUnauthorized)
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	data, err := h.Cache.Take("oidc:state:" + state)
+	if err != nil {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	var login oidcLogin
+	if err := json.Unmarshal([]byte(data), &login); err != nil {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := h.Provider.Exchange(r.Context(), q.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		logger.Log.Warn("oidc sign-in failed", zap.Error(err))
+		h.loginFailed(r, "oidc_exchange", "", "")
+		http.Error(w, "sign-in failed", http.StatusUnauthorized)
+		return
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		h.loginFailed(r, "oidc_email_unverified", claims.Subject, claims.Email)
+		http.Error(w, "email not verified", http.StatusForbidden)
+		return
+	}
+
+	user, outcome, revoked, err := h.Identities.Resolve(r.Context(), h.Provider.Issuer, claims.Subject, claims.Email)
+	if err == nil {
+		err = denySessions(h.Auth.Denylist, revoked)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("oidc sign-in",
+		zap.Int("user_id", user.ID), zap.String("subject", claims.Subject), zap.String("identity", outcome),
+		zap.Int("sessions_revoked", len(revoked)))
+	if outcome == models.IdentityProvisioned {
+		audit.Record(r, models.AuditEvent{
+			Action:     models.AuditUserCreated,
+			ActorID:    audit.Actor(user.ID),
+			TargetType: "user",
+			TargetID:   strconv.Itoa(user.ID),
+			After:      user.Profile(),
+		})
+	}
+
+	// The provider stands in for the password only; 2FA still applies.
+	challenge, err := h.Auth.mfaChallenge(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if challenge != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	tokens, err := h.Auth.startSession(r, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// loginFailed counts and audits a sign-in the provider didn't vouch for. The
+// subject and email are known once the provider answered.
+func (h *OIDCHandler) loginFailed(r *http.Request, reason, subject, email string) {
+	metrics.LoginFailures.WithLabelValues(reason).Inc()
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditLoginFailed,
+		TargetType: "oidc",
+		TargetID:   h.Provider.Issuer,
+		After:      map[string]string{"reason": reason, "subject": subject, "email": email},
+	})
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/auth"
+	"GoProjects/TaskTracker/internal/cache"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/oidc"
+	"GoProjects/TaskTracker/internal/oidc/mockidp"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// oidcTest is the app, with single sign-on through the mock IdP, and a browser.
+type oidcTest struct {
+	app     *httptest.Server
+	users   *store.UserStore
+	browser *http.Client
+}
+
+// newOIDCTest needs a migrated database at TEST_DATABASE_URL and Redis at
+// TEST_REDIS_ADDR, e.g. those of deploy/docker-compose.yml.
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	dsn, redisAddr := os.Getenv("TEST_DATABASE_URL"), os.Getenv("TEST_REDIS_ADDR")
+	if dsn == "" || redisAddr == "" {
+		t.Skip("TEST_DATABASE_URL and TEST_REDIS_ADDR not set")
+	}
+	ctx := context.Background()
+	logger.Init()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	redisCache := cache.NewRedisCache(redisAddr)
+	t.Cleanup(func() { redisCache.Close() })
+
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", "dGVzdC1vbmx5LWtleS1lbmNyeXB0aW9uLWtleS0zMmI=")
+	keys, err := auth.NewKeySet(store.NewSigningKeyStore(pool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	auth.UseKeys(keys)
+
+	// Both servers need each other's URL, so they get their handlers once started.
+	var appHandler, idpHandler http.Handler
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		appHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(app.Close)
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idpHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(idp.Close)
+
+	callback := app.URL + "/auth/oidc/callback"
+	mock, err := mockidp.New(mockidp.Config{
+		Issuer:       idp.URL,
+		ClientID:     "tasktracker",
+		ClientSecret: "tasktracker-secret",
+		RedirectURIs: []string{callback},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idpHandler = mock.Handler()
+
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "tasktracker",
+		ClientSecret: "tasktracker-secret",
+		RedirectURL:  callback,
+		Scopes:       []string{"openid", "email", "profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := store.NewUserStore(pool)
+	authHandler := &AuthHandler{
+		Store:         users,
+		Tokens:        store.NewRefreshTokenStore(pool),
+		Sessions:      store.NewSessionStore(pool),
+		MFA:           store.NewMFAStore(pool),
+		UserTokens:    store.NewUserTokenStore(pool),
+		AccessTokens:  store.NewAccessTokenStore(pool),
+		Denylist:      &auth.Denylist{Cache: redisCache},
+		Cache:         redisCache,
+		Lockout:       auth.NewLockout(redisCache),
+		Settings:      store.NewSettingsStore(pool),
+		PasswordLogin: true,
+	}
+	r := chi.NewRouter()
+	RegisterOIDCRoutes(r, authHandler, provider, store.NewIdentityStore(pool), redisCache)
+	appHandler = r
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &oidcTest{app: app, users: users, browser: browser}
+}
+
+// signIn goes through login, the mock IdP and the callback, and returns the
+// response of the callback.
+func (ot *oidcTest) signIn(t *testing.T, email string, emailVerified bool) *http.Response {
+	t.Helper()
+	resp, err := ot.browser.Get(ot.app.URL + "/auth/oidc/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login answered %s", resp.Status)
+	}
+
+	callback, err := mockidp.SignIn(ot.browser, resp.Header.Get("Location"), email, emailVerified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(callback, ot.app.URL+"/auth/oidc/callback?") {
+		t.Fatalf("IdP redirected to %s", callback)
+	}
+	resp, err = ot.browser.Get(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (ot *oidcTest) signedInUser(t *testing.T, resp *http.Response) int {
+	t.Helper()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("callback answered %s", resp.Status)
+	}
+	var tokens models.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.ParseToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("callback issued an unusable access token: %v", err)
+	}
+	if tokens.RefreshToken == "" {
+		t.Fatal("callback issued no refresh token")
+	}
+	return claims.UserID
+}
+
+func TestOIDCLoginProvisionsAndLinksUser(t *testing.T) {
+	ot := newOIDCTest(t)
+	email := fmt.Sprintf("sso-%d@example.com", time.Now().UnixNano())
+
+	userID := ot.signedInUser(t, ot.signIn(t, email, true))
+	user, err := ot.users.GetByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("no user was provisioned: %v", err)
+	}
+	if user.ID != userID {
+		t.Fatalf("tokens are for user %d, provisioned user is %d", userID, user.ID)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Fatal("the email the IdP verified is not marked verified")
+	}
+
+	if again := ot.signedInUser(t, ot.signIn(t, email, true)); again != userID {
+		t.Fatalf("second sign-in resolved to user %d, want %d", again, userID)
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedEmail(t *testing.T) {
+	ot := newOIDCTest(t)
+	email := fmt.Sprintf("sso-%d@example.com", time.Now().UnixNano())
+
+	resp := ot.signIn(t, email, false)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("callback answered %s, want 403", resp.Status)
+	}
+	if _, err := ot.users.GetByEmail(context.Background(), email); err == nil {
+		t.Fatal("a user was provisioned for an unverified email")
+	}
+}
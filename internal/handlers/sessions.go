@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/auth"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/store"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type SessionHandler struct {
+	Store    *store.SessionStore
+	Denylist *auth.Denylist
+}
+
+func RegisterSessionRoutes(r chi.Router, s *store.SessionStore, denylist *auth.Denylist) {
+	h := &SessionHandler{Store: s, Denylist: denylist}
+
+	r.Get("/auth/sessions", h.ListSessions)
+	r.Delete("/auth/sessions", h.RevokeAllSessions)
+	r.Delete("/auth/sessions/{sessionID}", h.RevokeSession)
+}
+
+// ListSessions godoc
+// @Summary      List sessions
+// @Description  Returns the active sessions of the authenticated user, one per login, most
+// @Description  recently used first. The session of the request is marked as current.
+// @Tags         auth
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.Session
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/sessions [get]
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.Store.List(r.Context(), claims.UserID, time.Now().Add(-auth.RefreshTokenTTL))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, s := range sessions {
+		s.Current = s.ID == claims.SessionID
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+// @Summary      Revoke session
+// @Description  Signs out one session of the authenticated user, e.g. of a lost device. Its
+// @Description  access and refresh tokens stop working.
+// @Tags         auth
+// @Param        sessionID  path  int  true  "Session ID"
+// @Security 	 BearerAuth
+// @Success      204
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "session not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/sessions/{sessionID} [delete]
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.Store.Revoke(r.Context(), userID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = denySessions(h.Denylist, []*models.Session{session})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions godoc
+// @Summary      Sign out everywhere
+// @Description  Revokes every session of the authenticated user, including the current one.
+// @Tags         auth
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.SessionsRevoked
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /auth/sessions [delete]
+func (h *SessionHandler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.Store.RevokeAll(r.Context(), claims.UserID)
+	if err == nil {
+		err = denySessions(h.Denylist, sessions)
+	}
+	if err == nil {
+		// Tokens issued before sessions existed have none to revoke.
+		err = h.Denylist.Revoke(claims.ID, claims.ExpiresAt.Time)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.SessionsRevoked{Revoked: len(sessions)})
+}
+
+// denySessions makes the access tokens of revoked sessions fail right away
+// rather than when they expire.
+func denySessions(denylist *auth.Denylist, sessions []*models.Session) error {
+	for _, s := range sessions {
+		if err := denylist.RevokeSession(s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientIP returns the address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/store"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type SettingsHandler struct {
+	Store *store.SettingsStore
+	// MFARequiredByConfig is set when MFA_REQUIRED overrides the setting.
+	MFARequiredByConfig bool
+}
+
+// RegisterSettingsRoutes adds the workspace settings for admins. It goes after
+// AuthMiddleware.
+func RegisterSettingsRoutes(r chi.Router, authHandler *AuthHandler) {
+	h := &SettingsHandler{Store: authHandler.Settings, MFARequiredByConfig: authHandler.MFARequired}
+
+	r.With(RejectAccessTokens, RequireVerifiedEmail, RequireAdmin(authHandler.Store)).Route("/admin/settings", func(r chi.Router) {
+		r.Get("/", h.GetSettings)
+		r.Patch("/", h.UpdateSettings)
+	})
+}
+
+// GetSettings godoc
+// @Summary      Get workspace settings
+// @Description  Returns the policies that apply to every user. Admins only.
+// @Tags         admin
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.WorkspaceSettings
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "admin role required"
+// @Failure      500  {string}  string "internal error"
+// @Router       /admin/settings [get]
+func (h *SettingsHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Store.Get(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	settings.MFARequiredByConfig = h.MFARequiredByConfig
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// UpdateSettings godoc
+// @Summary      Update workspace settings
+// @Description  Changes the policies that apply to every user. With mfa_required users without
+// @Description  two-factor authentication have to set it up at their next login, and nobody can
+// @Description  turn it off. Admins only.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security 	 BearerAuth
+// @Param        request  body      models.UpdateWorkspaceSettingsRequest  true  "Settings to change"
+// @Success      200  {object}  models.WorkspaceSettings
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "admin role required"
+// @Failure      500  {string}  string "internal error"
+// @Router       /admin/settings [patch]
+func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateWorkspaceSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.Store.Get(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	settings := before
+	if req.MFARequired != nil && *req.MFARequired != before.MFARequired {
+		userID := r.Context().Value("userID").(int)
+		settings, err = h.Store.SetMFARequired(r.Context(), *req.MFARequired, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Log.Info("mfa requirement changed", zap.Bool("required", settings.MFARequired), zap.Int("by", userID))
+		audit.Record(r, models.AuditEvent{
+			Action:     models.AuditSettingsChanged,
+			TargetType: "workspace",
+			Before:     before,
+			After:      settings,
+		})
+	}
+	settings.MFARequiredByConfig = h.MFARequiredByConfig
+	writeJSON(w, http.StatusOK, settings)
+}
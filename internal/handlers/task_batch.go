@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/audit"
+	"GoProjects/TaskTracker/internal/metrics"
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/queue"
+	"GoProjects/TaskTracker/internal/realtime"
+	"GoProjects/TaskTracker/internal/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxBatchOperations = 200
+
+// batchError is a failed batch operation and the status it is reported with.
+type batchError struct {
+	status int
+	msg    string
+}
+
+func (e *batchError) Error() string {
+	return e.msg
+}
+
+// batchChanges collects the effects of a batch so that notifications and
+// cache invalidation happen once per batch rather than once per operation.
+type batchChanges struct {
+	Created []*models.Task `json:"created,omitempty"`
+	Updated []*models.Task `json:"updated,omitempty"`
+	Deleted []int          `json:"deleted,omitempty"`
+
+	// audits are the audit entries of the changes, recorded once the batch is applied.
+	audits []models.AuditEvent
+}
+
+// record adds a successful operation. before is the task as it was read for
+// updates, moves and deletes.
+func (c *batchChanges) record(op string, status int, before, task *models.Task) {
+	switch {
+	case task == nil:
+		return
+	case op == models.BatchOpCreate:
+		c.Created = append(c.Created, task)
+		c.audit(models.AuditTaskCreated, nil, task)
+	case op == models.BatchOpDelete:
+		c.Deleted = append(c.Deleted, task.ID)
+		c.audit(models.AuditTaskDeleted, before, nil)
+	case status == http.StatusOK:
+		c.Updated = append(c.Updated, task)
+		if before == nil || before.Version != task.Version {
+			c.audit(models.AuditTaskUpdated, before, task)
+		}
+	}
+}
+
+func (c *batchChanges) audit(action string, before, after *models.Task) {
+	c.audits = append(c.audits, audit.TaskEvent(action, before, after))
+}
+
+func (c *batchChanges) empty() bool {
+	return len(c.Created) == 0 && len(c.Updated) == 0 && len(c.Deleted) == 0
+}
+
+// BatchTasks godoc
+// @Summary      Batch task operations
+// @Description  Applies up to 200 create, update, delete and move operations. In "atomic" mode
+// @Description  (default) all operations run in one transaction and nothing is applied if any
+// @Description  of them fails. In "best_effort" mode every operation is applied on its own.
+// @Description  Each operation gets its own result with an HTTP status code.
+// @Tags         tasks
+// @Accept       json
+// @Produce      json
+// @Param        batch  body      models.BatchRequest  true  "Operations"
+// @Param        Idempotency-Key  header  string  false  "Unique key to make retries safe"
+// @Security 	 BearerAuth
+// @Success      200    {object}  models.BatchResponse
+// @Failure      400    {string}  string "invalid input"
+// @Failure      401    {string}  string "unauthorized"
+// @Failure      409    {object}  models.BatchResponse
+// @Failure      500    {string}  string "internal error"
+// @Router       /tasks/batch [post]
+func (h *TaskHandler) BatchTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<20)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = models.BatchAtomic
+	}
+	if req.Mode != models.BatchAtomic && req.Mode != models.BatchBestEffort {
+		http.Error(w, "mode must be atomic or best_effort", http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) == 0 {
+		http.Error(w, "no operations", http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		http.Error(w, "too many operations, max "+strconv.Itoa(maxBatchOperations), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	resp := models.BatchResponse{Mode: req.Mode, Committed: true, Results: make([]models.BatchResult, len(req.Operations))}
+	changes := &batchChanges{}
+
+	if req.Mode == models.BatchBestEffort {
+		for i, op := range req.Operations {
+			var status int
+			var before, task *models.Task
+			err := h.Store.InTx(ctx, func(tx *store.TaskStore) error {
+				var opErr error
+				status, before, task, opErr = h.applyBatchOp(ctx, tx, userID, op)
+				return opErr
+			})
+			resp.Results[i] = batchResult(i, op, status, task, err)
+			if err == nil {
+				changes.record(op.Op, status, before, task)
+			}
+		}
+		writeJSON(w, http.StatusOK, resp)
+		h.batchApplied(r, userID, changes)
+		return
+	}
+
+	failed := -1
+	err := h.Store.InTx(ctx, func(tx *store.TaskStore) error {
+		for i, op := range req.Operations {
+			status, before, task, err := h.applyBatchOp(ctx, tx, userID, op)
+			resp.Results[i] = batchResult(i, op, status, task, err)
+			if err != nil {
+				failed = i
+				return err
+			}
+			changes.record(op.Op, status, before, task)
+		}
+		return nil
+	})
+	if err != nil {
+		if failed < 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Committed = false
+		for i, op := range req.Operations {
+			switch {
+			case i < failed:
+				resp.Results[i] = models.BatchResult{Index: i, Op: op.Op, Status: http.StatusFailedDependency, Error: "rolled back"}
+			case i > failed:
+				resp.Results[i] = models.BatchResult{Index: i, Op: op.Op, Status: http.StatusFailedDependency, Error: "not attempted"}
+			}
+		}
+		if resp.Results[failed].Status >= http.StatusInternalServerError {
+			writeJSON(w, http.StatusInternalServerError, resp)
+			return
+		}
+		writeJSON(w, http.StatusConflict, resp)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+	h.batchApplied(r, userID, changes)
+}
+
+func batchResult(i int, op models.BatchOperation, status int, task *models.Task, err error) models.BatchResult {
+	res := models.BatchResult{Index: i, Op: op.Op, Status: status}
+	if err != nil {
+		var be *batchError
+		if !errors.As(err, &be) {
+			res.Status = http.StatusInternalServerError
+		}
+		res.Error = err.Error()
+		return res
+	}
+	if op.Op != models.BatchOpDelete {
+		res.Task = task
+	}
+	return res
+}
+
+// applyBatchOp runs a single operation against s and returns the status to
+// report, the task before the operation and the task it produced. Client
+// errors are returned as *batchError.
+func (h *TaskHandler) applyBatchOp(ctx context.Context, s *store.TaskStore, userID int, op models.BatchOperation) (int, *models.Task, *models.Task, error) {
+	fail := func(status int, msg string) (int, *models.Task, *models.Task, error) {
+		return status, nil, nil, &batchError{status: status, msg: msg}
+	}
+
+	if op.Op == models.BatchOpCreate {
+		if op.Task == nil {
+			return fail(http.StatusUnprocessableEntity, "task is required")
+		}
+		patch := *op.Task
+		t := &models.Task{Status: models.StatusTodo, UserID: userID}
+		if patch.Title == nil {
+			patch.Title = &t.Title
+		}
+		if errs := patch.Validate(); len(errs) > 0 {
+			return fail(http.StatusUnprocessableEntity, fieldErrorsText(errs))
+		}
+		t.Title = *patch.Title
+		if patch.Description != nil {
+			t.Description = *patch.Description
+		}
+		if patch.Status != nil {
+			t.Status = *patch.Status
+		}
+		t.DueAt = patch.DueAt.Time
+		if err := s.Create(ctx, t); err != nil {
+			if errors.Is(err, store.ErrWIPLimit) {
+				return fail(http.StatusConflict, err.Error())
+			}
+			return http.StatusInternalServerError, nil, nil, err
+		}
+		return http.StatusCreated, nil, t, nil
+	}
+
+	current, err := s.Get(ctx, op.ID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && current.UserID != userID) {
+		return fail(http.StatusNotFound, "task not found")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	expectedVersion := 0
+	if op.IfMatch != "" {
+		if !taskIfMatch(op.IfMatch, current) {
+			return fail(http.StatusPreconditionFailed, "task was modified")
+		}
+		expectedVersion = current.Version
+	}
+
+	var patch models.TaskPatch
+	switch op.Op {
+	case models.BatchOpDelete:
+		if err := s.Delete(ctx, current.ID); err != nil {
+			return http.StatusInternalServerError, nil, nil, err
+		}
+		return http.StatusNoContent, current, current, nil
+	case models.BatchOpUpdate:
+		if op.Task == nil || op.Task.IsEmpty() {
+			return fail(http.StatusUnprocessableEntity, "task is required")
+		}
+		patch = *op.Task
+	case models.BatchOpMove:
+		patch.Status = &op.Status
+	default:
+		return fail(http.StatusBadRequest, "unknown op "+strconv.Quote(op.Op))
+	}
+
+	if errs := patch.Validate(); len(errs) > 0 {
+		return fail(http.StatusUnprocessableEntity, fieldErrorsText(errs))
+	}
+	updated, err := s.Patch(ctx, userID, current.ID, patch, expectedVersion)
+	if errors.Is(err, store.ErrVersionConflict) {
+		return fail(http.StatusPreconditionFailed, "task was modified")
+	}
+	if errors.Is(err, store.ErrWIPLimit) {
+		return fail(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, nil, err
+	}
+	return http.StatusOK, current, updated, nil
+}
+
+func fieldErrorsText(errs []models.FieldError) string {
+	parts := make([]string, len(errs))
+	for i, e := range errs {
+		parts[i] = e.Field + ": " + e.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// batchApplied sends one notification to the clients of the user and one cache
+// invalidation for the whole batch and audits its changes.
+func (h *TaskHandler) batchApplied(r *http.Request, userID int, changes *batchChanges) {
+	if changes.empty() {
+		return
+	}
+	for _, e := range changes.audits {
+		audit.Record(r, e)
+	}
+
+	h.Hub.BroadcastTo(userID, realtime.Message{
+		Type: "tasks_batch",
+		Data: changes,
+	})
+	h.publish(queue.EventTaskBatch, changes)
+	metrics.TaskCreated.Add(float64(len(changes.Created)))
+
+	keys := []string{"tasks:user:" + strconv.Itoa(userID)}
+	seen := make(map[int]bool)
+	addTask := func(id int) {
+		if !seen[id] {
+			seen[id] = true
+			keys = append(keys, "task:"+strconv.Itoa(id))
+		}
+	}
+	for _, t := range changes.Updated {
+		addTask(t.ID)
+	}
+	for _, id := range changes.Deleted {
+		addTask(id)
+	}
+	_ = h.Cache.DeleteMany(keys...)
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/models"
+	"encoding/csv"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushEvery is how many rows are written between flushes to the client.
+const exportFlushEvery = 100
+
+var exportCSVHeader = []string{"id", "title", "description", "status", "user_id", "version", "created_at", "updated_at", "due_at"}
+
+func exportCSVRow(t *models.Task) []string {
+	return []string{
+		strconv.Itoa(t.ID),
+		csvSafe(t.Title),
+		csvSafe(t.Description),
+		t.Status,
+		strconv.Itoa(t.UserID),
+		strconv.Itoa(t.Version),
+		t.CreatedAt.Format(time.RFC3339),
+		t.UpdatedAt.Format(time.RFC3339),
+		formatTime(t.DueAt),
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// csvSafe keeps spreadsheet applications from evaluating user text as a formula.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// ExportTasks godoc
+// @Summary      Export tasks
+// @Description  Streams the tasks of the authenticated user as CSV, a JSON array or
+// @Description  newline-delimited JSON. Accepts the same filters as ListTasks.
+// @Tags         tasks
+// @Produce      text/csv
+// @Produce      json
+// @Produce      application/x-ndjson
+// @Param        format  query   string  false  "csv (default), json or ndjson"
+// @Param        status  query   string  false  "Only tasks in this status"
+// @Param        q       query   string  false  "Only tasks whose title or description contains this text"
+// @Security 	 BearerAuth
+// @Success      200  {file}    file
+// @Failure      400  {string}  string "invalid filter"
+// @Failure      401  {string}  string "unauthorized"
+// @Router       /tasks/export [get]
+func (h *TaskHandler) ExportTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseTaskFilter(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "json":
+		contentType = "application/json"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		http.Error(w, "format must be csv, json or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	filename := "tasks-" + time.Now().UTC().Format("20060102") + "." + format
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	rc := http.NewResponseController(w)
+	rows := 0
+	// flush counts the row and periodically pushes buffered output to the client.
+	flush := func(buffered func()) {
+		rows++
+		if rows%exportFlushEvery == 0 {
+			if buffered != nil {
+				buffered()
+			}
+			_ = rc.Flush()
+		}
+	}
+
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write(exportCSVHeader)
+		err = h.Store.Stream(r.Context(), filter, func(t *models.Task) error {
+			if err := cw.Write(exportCSVRow(t)); err != nil {
+				return err
+			}
+			flush(cw.Flush)
+			return cw.Error()
+		})
+		cw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		_, _ = w.Write([]byte("["))
+		err = h.Store.Stream(r.Context(), filter, func(t *models.Task) error {
+			if rows > 0 {
+				if _, err := w.Write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			flush(nil)
+			return enc.Encode(t)
+		})
+		_, _ = w.Write([]byte("]\n"))
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		err = h.Store.Stream(r.Context(), filter, func(t *models.Task) error {
+			flush(nil)
+			return enc.Encode(t)
+		})
+	}
+
+	// Headers are already sent, the client sees a truncated file.
+	if err != nil {
+		logger.Log.Error("export failed", zap.Error(err), zap.Int("rows", rows))
+	}
+}
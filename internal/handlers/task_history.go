@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/store"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+)
+
+// GetTaskHistory godoc
+// @Summary      Get task history
+// @Description  Returns every recorded revision of the task with field-level changes, oldest first.
+// @Description  Revisions are numbered by the version they produced; moves within a board column
+// @Description  change no field and are skipped.
+// @Tags         tasks
+// @Produce      json
+// @Param        id   path      int  true  "Task ID"
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.TaskRevision
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/history [get]
+func (h *TaskHandler) GetTaskHistory(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Store)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.Store.History(r.Context(), task.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, revisions)
+}
+
+// GetTaskRevision godoc
+// @Summary      Get task revision
+// @Description  Returns the task as it was at revision n
+// @Tags         tasks
+// @Produce      json
+// @Param        id   path      int  true  "Task ID"
+// @Param        n    path      int  true  "Revision number"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.TaskRevision
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "revision not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/revisions/{n} [get]
+func (h *TaskHandler) GetTaskRevision(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Store)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil {
+		http.Error(w, "invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := h.Store.Revision(r.Context(), task.ID, n)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "revision not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, revision)
+}
+
+// RevertTask godoc
+// @Summary      Revert task to revision
+// @Description  Restores the fields of revision n. The revert is recorded as a new revision.
+// @Tags         tasks
+// @Produce      json
+// @Param        id        path    int     true   "Task ID"
+// @Param        n         path    int     true   "Revision number"
+// @Param        If-Match  header  string  false  "ETag of the task version being reverted"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.Task
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "revision not found"
+// @Failure      409  {string}  string "WIP limit reached"
+// @Failure      412  {string}  string "task was modified"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/revisions/{n}/revert [post]
+func (h *TaskHandler) RevertTask(w http.ResponseWriter, r *http.Request) {
+	current, ok := loadOwnedTask(w, r, h.Store)
+	if !ok {
+		return
+	}
+	expectedVersion := 0
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !taskIfMatch(ifMatch, current) {
+			http.Error(w, "task was modified", http.StatusPreconditionFailed)
+			return
+		}
+		expectedVersion = current.Version
+	}
+
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil {
+		http.Error(w, "invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := h.Store.Revision(r.Context(), current.ID, n)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "revision not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.Store.Patch(r.Context(), current.UserID, current.ID, revision.Snapshot.Patch(), expectedVersion)
+	if err != nil {
+		if errors.Is(err, store.ErrVersionConflict) {
+			http.Error(w, "task was modified", http.StatusPreconditionFailed)
+			return
+		}
+		if errors.Is(err, store.ErrWIPLimit) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(updated))
+	writeJSON(w, http.StatusOK, updated)
+	if updated.Version != current.Version {
+		h.taskUpdated(r, current, updated)
+	}
+}
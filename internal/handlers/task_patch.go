@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// errPatchTestFailed is returned when a JSON Patch "test" operation doesn't hold.
+var errPatchTestFailed = errors.New("patch test failed")
+
+// patchableFields are the task fields a client may change with PATCH.
+var patchableFields = map[string]bool{"title": true, "description": true, "status": true, "due_at": true}
+
+// fieldDefault is the value a patchable field is reset to when it is removed.
+func fieldDefault(field string) string {
+	if field == "status" {
+		return models.StatusTodo
+	}
+	return ""
+}
+
+// parseFieldMask parses the comma separated "fields" query parameter.
+// It returns nil when no mask was given.
+func parseFieldMask(raw string) (map[string]bool, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	mask := make(map[string]bool)
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if !patchableFields[field] {
+			return nil, fmt.Errorf("field %q can't be updated", field)
+		}
+		mask[field] = true
+	}
+	return mask, nil
+}
+
+// decodeMergePatch turns an RFC 7396 JSON Merge Patch document into a TaskPatch.
+// A null member resets the field to its default. With a mask, only masked fields
+// are applied and masked fields missing from the document are reset as well.
+func decodeMergePatch(body []byte, mask map[string]bool) (models.TaskPatch, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil || doc == nil {
+		return models.TaskPatch{}, errors.New("merge patch must be a JSON object")
+	}
+
+	values := make(map[string]string)
+	for field, raw := range doc {
+		if !patchableFields[field] {
+			return models.TaskPatch{}, fmt.Errorf("field %q can't be updated", field)
+		}
+		if mask != nil && !mask[field] {
+			continue
+		}
+		var v *string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return models.TaskPatch{}, fmt.Errorf("field %q must be a string or null", field)
+		}
+		if v == nil {
+			values[field] = fieldDefault(field)
+			continue
+		}
+		values[field] = *v
+	}
+	for field := range mask {
+		if _, ok := values[field]; !ok {
+			values[field] = fieldDefault(field)
+		}
+	}
+	return patchFromValues(values)
+}
+
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies an RFC 6902 JSON Patch document to the current task
+// and returns the fields it touched. Only top level string fields are supported;
+// due_at is handled as an RFC 3339 string where "" means no due date.
+func applyJSONPatch(body []byte, current *models.Task, mask map[string]bool) (models.TaskPatch, error) {
+	var ops []jsonPatchOp
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return models.TaskPatch{}, errors.New("json patch must be an array of operations")
+	}
+
+	doc := map[string]string{
+		"title":       current.Title,
+		"description": current.Description,
+		"status":      current.Status,
+		"due_at":      formatTime(current.DueAt),
+	}
+	touched := make(map[string]string)
+
+	field := func(pointer string) (string, error) {
+		name := strings.TrimPrefix(pointer, "/")
+		if !strings.HasPrefix(pointer, "/") || !patchableFields[name] {
+			return "", fmt.Errorf("path %q can't be patched", pointer)
+		}
+		if mask != nil && !mask[name] {
+			return "", fmt.Errorf("path %q is outside the field mask", pointer)
+		}
+		return name, nil
+	}
+	value := func(op jsonPatchOp) (string, error) {
+		var v string
+		if err := json.Unmarshal(op.Value, &v); err != nil {
+			return "", fmt.Errorf("%s %s: value must be a string", op.Op, op.Path)
+		}
+		return v, nil
+	}
+
+	for _, op := range ops {
+		name, err := field(op.Path)
+		if err != nil {
+			return models.TaskPatch{}, err
+		}
+
+		switch op.Op {
+		case "add", "replace":
+			v, err := value(op)
+			if err != nil {
+				return models.TaskPatch{}, err
+			}
+			doc[name] = v
+			touched[name] = v
+		case "remove":
+			doc[name] = fieldDefault(name)
+			touched[name] = doc[name]
+		case "copy", "move":
+			from, err := field(op.From)
+			if err != nil {
+				return models.TaskPatch{}, err
+			}
+			doc[name] = doc[from]
+			touched[name] = doc[name]
+			if op.Op == "move" && from != name {
+				doc[from] = fieldDefault(from)
+				touched[from] = doc[from]
+			}
+		case "test":
+			v, err := value(op)
+			if err != nil {
+				return models.TaskPatch{}, err
+			}
+			if doc[name] != v {
+				return models.TaskPatch{}, fmt.Errorf("%w: %s", errPatchTestFailed, op.Path)
+			}
+		default:
+			return models.TaskPatch{}, fmt.Errorf("unsupported op %q", op.Op)
+		}
+	}
+	return patchFromValues(touched)
+}
+
+func patchFromValues(values map[string]string) (models.TaskPatch, error) {
+	var p models.TaskPatch
+	for field, v := range values {
+		switch field {
+		case "title":
+			p.Title = &v
+		case "description":
+			p.Description = &v
+		case "status":
+			p.Status = &v
+		case "due_at":
+			p.DueAt.Set = true
+			if v == "" {
+				continue
+			}
+			due, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return models.TaskPatch{}, fmt.Errorf("field %q must be an RFC 3339 timestamp", field)
+			}
+			p.DueAt.Time = &due
+		}
+	}
+	return p, nil
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"GoProjects/TaskTracker/internal/audit"
 	"GoProjects/TaskTracker/internal/cache"
 	"GoProjects/TaskTracker/internal/logger"
 	"GoProjects/TaskTracker/internal/metrics"
@@ -10,8 +11,12 @@ import (
 	"GoProjects/TaskTracker/internal/store"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
+	"io"
+	"mime"
 	"time"
 
 	"net/http"
@@ -28,13 +33,66 @@ type TaskHandler struct {
 func RegisterTaskRoutes(r chi.Router, s *store.TaskStore, hub *realtime.Hub, broker *queue.Broker, cache *cache.RedisCache) {
 	h := &TaskHandler{Store: s, Hub: hub, Broker: broker, Cache: cache}
 
+	idempotent := Idempotency(cache)
+
 	r.Route("/tasks", func(r chi.Router) {
 		r.Get("/", h.ListTasks)
-		r.Post("/", h.CreateTask)
+		r.Get("/export", h.ExportTasks)
+		r.With(idempotent).Post("/", h.CreateTask)
+		r.With(idempotent).Post("/batch", h.BatchTasks)
 		r.Get("/{id}", h.GetTask)
-		r.Put("/{id}", h.UpdateTask)
-		r.Delete("/{id}", h.DeleteTask)
+		r.With(idempotent).Put("/{id}", h.UpdateTask)
+		r.With(idempotent).Patch("/{id}", h.PatchTask)
+		r.With(idempotent).Delete("/{id}", h.DeleteTask)
+		r.Get("/{id}/presence", h.GetTaskPresence)
+		r.Get("/{id}/history", h.GetTaskHistory)
+		r.Get("/{id}/revisions/{n}", h.GetTaskRevision)
+		r.Post("/{id}/revisions/{n}/revert", h.RevertTask)
+		r.Post("/{id}/restore", h.RestoreTask)
+		r.With(idempotent).Post("/{id}/move", h.MoveTask)
 	})
+	r.Get("/trash", h.ListTrash)
+}
+
+// parseTaskFilter reads the list filters shared by ListTasks and ExportTasks.
+func parseTaskFilter(r *http.Request, userID int) (store.TaskFilter, error) {
+	q := r.URL.Query()
+	f := store.TaskFilter{UserID: userID, Status: q.Get("status"), Query: q.Get("q")}
+	if f.Status != "" && !models.IsValidStatus(f.Status) {
+		return f, errors.New("unknown status " + strconv.Quote(f.Status))
+	}
+	return f, nil
+}
+
+// loadOwnedTask parses the {id} URL parameter and loads the task, making sure it
+// belongs to the authenticated user. On failure it writes the response itself.
+func loadOwnedTask(w http.ResponseWriter, r *http.Request, s *store.TaskStore) (*models.Task, bool) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	task, err := s.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "task not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if task.UserID != userID {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return nil, false
+	}
+	return task, true
 }
 
 // ListTasks godoc
@@ -42,8 +100,13 @@ func RegisterTaskRoutes(r chi.Router, s *store.TaskStore, hub *realtime.Hub, bro
 // @Description  Returns list of tasks belonging to the authenticated user
 // @Tags         tasks
 // @Produce      json
+// @Param        status         query   string  false  "Only tasks in this status"
+// @Param        q              query   string  false  "Only tasks whose title or description contains this text"
+// @Param        If-None-Match  header  string  false  "ETag of a previously fetched list"
 // @Security     BearerAuth
 // @Success      200  {array}   models.Task
+// @Success      304  {string}  string "not modified"
+// @Failure      400  {string}  string "invalid filter"
 // @Failure      401  {string}  string "unauthorized"
 // @Failure      500  {string}  string "internal error"
 // @Router       /tasks [get]
@@ -54,42 +117,60 @@ func (h *TaskHandler) ListTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter, err := parseTaskFilter(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only the unfiltered list is cached, filtered lists always hit the database.
 	cacheKey := "tasks:user:" + strconv.Itoa(userID)
-	cached, err := h.Cache.Get(cacheKey)
+	unfiltered := filter == store.TaskFilter{UserID: userID}
+	var data []byte
+	if cached, err := h.Cache.Get(cacheKey); unfiltered && err == nil && cached != "" {
+		data = []byte(cached)
+	} else {
+		tasks, err := h.Store.List(context.Background(), filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	if cached != "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(cached))
-		return
+		data, err = json.Marshal(tasks)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if unfiltered {
+			_ = h.Cache.Set(cacheKey, string(data), 30*time.Second)
+		}
 	}
 
-	tasks, err := h.Store.List(context.Background(), userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	etag := bodyETag(data)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	data, err := json.Marshal(tasks)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(data)
-	if err != nil {
-		return
-	}
-
-	_ = h.Cache.Set(cacheKey, string(data), 30*time.Second)
 }
 
 // CreateTask godoc
 // @Summary      Create task
-// @Description  Creates a new task for the authenticated user
+// @Description  Creates a new task for the authenticated user. The status defaults to todo.
 // @Tags         tasks
 // @Accept       json
 // @Produce      json
 // @Param        task  body      models.TaskRequest  true  "Task info"
+// @Param        Idempotency-Key  header  string  false  "Unique key to make retries safe"
 // @Security 	 BearerAuth
 // @Success      201   {object}  models.Task
 // @Failure      400   {string}  string "invalid input"
 // @Failure      401   {string}  string "unauthorized"
+// @Failure      409   {string}  string "WIP limit reached"
+// @Failure      422   {object}  map[string][]models.FieldError
 // @Failure      500   {string}  string "internal error"
 // @Router       /tasks [post]
 func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
@@ -105,18 +186,31 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	task.UserID = userID
+	if task.Status == "" {
+		task.Status = models.StatusTodo
+	}
+	if errs := taskFieldErrors(&task); len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string][]models.FieldError{"errors": errs})
+		return
+	}
 
 	if err := h.Store.Create(context.Background(), &task); err != nil {
+		if errors.Is(err, store.ErrWIPLimit) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", taskETag(&task))
 	w.WriteHeader(http.StatusCreated)
 	err := json.NewEncoder(w).Encode(task)
 	if err != nil {
 		return
 	}
 	metrics.TaskCreated.Inc()
+	auditTask(r, models.AuditTaskCreated, nil, &task)
 	h.Hub.Broadcast(realtime.Message{
 		Type: "task_created",
 		Data: task,
@@ -140,14 +234,17 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 
 // GetTask godoc
 // @Summary      Get task by ID
-// @Description  Returns a single task by its ID
+// @Description  Returns a single task by its ID. The task version is returned as ETag.
 // @Tags         tasks
 // @Produce      json
-// @Param        id   path      int  true  "Task ID"
+// @Param        id             path    int     true   "Task ID"
+// @Param        If-None-Match  header  string  false  "ETag of a previously fetched task"
 // @Security 	 BearerAuth
 // @Success      200  {object}  models.Task
+// @Success      304  {string}  string "not modified"
 // @Failure      400  {string}  string "invalid id"
 // @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
 // @Failure      500  {string}  string "internal error"
 // @Router       /tasks/{id} [get]
 func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
@@ -159,60 +256,87 @@ func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID, ok := r.Context().Value("userID").(int)
-	if !ok || userID != id {
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	cacheKey := "task:" + idStr
 
-	cached, err := h.Cache.Get(cacheKey)
-	if err == nil && cached != "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(cached))
-		return
+	var task *models.Task
+	if cached, err := h.Cache.Get(cacheKey); err == nil && cached != "" {
+		t := &models.Task{}
+		if json.Unmarshal([]byte(cached), t) == nil {
+			task = t
+		}
+	}
+	if task == nil {
+		task, err = h.Store.Get(context.Background(), id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "task not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if data, err := json.Marshal(task); err == nil {
+			_ = h.Cache.Set(cacheKey, string(data), 30*time.Second)
+		}
 	}
 
-	task, err := h.Store.Get(context.Background(), id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if task.UserID != userID {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
 	}
 
-	data, err := json.Marshal(task)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
-	if err != nil {
+	etag := taskETag(task)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	_ = h.Cache.Set(cacheKey, string(data), 30*time.Second)
+	writeJSON(w, http.StatusOK, task)
 }
 
 // UpdateTask godoc
 // @Summary      Update task
-// @Description  Updates an existing task for the authenticated user
+// @Description  Replaces an existing task of the authenticated user: the title and status are
+// @Description  required, an omitted description or due_at is cleared. Use PATCH to change
+// @Description  single fields. Requires If-Match with the ETag returned by GetTask or a
+// @Description  previous update.
 // @Tags         tasks
 // @Accept       json
 // @Produce      json
-// @Param        id    path      int         true  "Task ID"
-// @Param        task  body      models.TaskRequest true  "Task info"
+// @Param        id        path    int                 true  "Task ID"
+// @Param        If-Match  header  string              true  "ETag of the task version being updated"
+// @Param        task      body    models.TaskRequest  true  "Task info"
+// @Param        Idempotency-Key  header  string  false  "Unique key to make retries safe"
 // @Security 	 BearerAuth
 // @Success      200   {object}  models.Task
 // @Failure      400   {string}  string "invalid input"
 // @Failure      401   {string}  string "unauthorized"
+// @Failure      404   {string}  string "task not found"
+// @Failure      409   {string}  string "WIP limit reached"
+// @Failure      412   {string}  string "task was modified"
+// @Failure      422   {object}  map[string][]models.FieldError
+// @Failure      428   {string}  string "If-Match header required"
 // @Failure      500   {string}  string "internal error"
 // @Router       /tasks/{id} [put]
 func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "invalid id", http.StatusBadRequest)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "If-Match header required", http.StatusPreconditionRequired)
 		return
 	}
 
-	userID, ok := r.Context().Value("userID").(int)
-	if !ok || userID != id {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	current, ok := loadOwnedTask(w, r, h.Store)
+	if !ok {
+		return
+	}
+	if !taskIfMatch(ifMatch, current) {
+		http.Error(w, "task was modified", http.StatusPreconditionFailed)
 		return
 	}
 
@@ -221,75 +345,296 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	t.ID = id
-	updated, err := h.Store.Update(context.Background(), &t)
+	if errs := taskFieldErrors(&t); len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string][]models.FieldError{"errors": errs})
+		return
+	}
+	t.ID = current.ID
+	updated, err := h.Store.Update(context.Background(), current.UserID, &t, current.Version)
 	if err != nil {
+		if errors.Is(err, store.ErrVersionConflict) {
+			http.Error(w, "task was modified", http.StatusPreconditionFailed)
+			return
+		}
+		if errors.Is(err, store.ErrWIPLimit) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "task not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(updated)
+	w.Header().Set("ETag", taskETag(updated))
+	writeJSON(w, http.StatusOK, updated)
+	if updated.Version != current.Version {
+		h.taskUpdated(r, current, updated)
+	}
+}
+
+// PatchTask godoc
+// @Summary      Partially update task
+// @Description  Applies a JSON Merge Patch (application/merge-patch+json, RFC 7396) or a
+// @Description  JSON Patch (application/json-patch+json, RFC 6902) to the task. Only the
+// @Description  fields present in the patch are written. The optional "fields" mask limits
+// @Description  which fields are applied; masked fields missing from a merge patch are reset.
+// @Tags         tasks
+// @Accept       json
+// @Produce      json
+// @Param        id        path    int                 true   "Task ID"
+// @Param        If-Match  header  string              false  "ETag of the task version being patched"
+// @Param        fields    query   string              false  "Comma separated field mask, e.g. title,status"
+// @Param        patch     body    models.TaskRequest  true   "Merge patch document"
+// @Param        Idempotency-Key  header  string  false  "Unique key to make retries safe"
+// @Security 	 BearerAuth
+// @Success      200   {object}  models.Task
+// @Failure      400   {string}  string "invalid patch"
+// @Failure      401   {string}  string "unauthorized"
+// @Failure      404   {string}  string "task not found"
+// @Failure      409   {string}  string "patch test failed or WIP limit reached"
+// @Failure      412   {string}  string "task was modified"
+// @Failure      415   {string}  string "unsupported patch format"
+// @Failure      422   {object}  map[string][]models.FieldError
+// @Failure      500   {string}  string "internal error"
+// @Router       /tasks/{id} [patch]
+func (h *TaskHandler) PatchTask(w http.ResponseWriter, r *http.Request) {
+	current, ok := loadOwnedTask(w, r, h.Store)
+	if !ok {
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !taskIfMatch(ifMatch, current) {
+		http.Error(w, "task was modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	mask, err := parseFieldMask(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// JSON Patch is applied to the version we just read, so the write must be
+	// conditional on it even when the client didn't send If-Match.
+	expectedVersion := 0
+	var patch models.TaskPatch
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case mergePatchContentType, "application/json", "":
+		patch, err = decodeMergePatch(body, mask)
+		if ifMatch != "" {
+			expectedVersion = current.Version
+		}
+	case jsonPatchContentType:
+		patch, err = applyJSONPatch(body, current, mask)
+		expectedVersion = current.Version
+	default:
+		http.Error(w, "unsupported patch format", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, errPatchTestFailed) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errs := patch.Validate(); len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string][]models.FieldError{"errors": errs})
+		return
+	}
+	if patch.IsEmpty() {
+		w.Header().Set("ETag", taskETag(current))
+		writeJSON(w, http.StatusOK, current)
+		return
+	}
+
+	updated, err := h.Store.Patch(r.Context(), current.UserID, current.ID, patch, expectedVersion)
 	if err != nil {
+		if errors.Is(err, store.ErrVersionConflict) {
+			http.Error(w, "task was modified", http.StatusPreconditionFailed)
+			return
+		}
+		if errors.Is(err, store.ErrWIPLimit) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "task not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	w.Header().Set("ETag", taskETag(updated))
+	writeJSON(w, http.StatusOK, updated)
+	if updated.Version != current.Version {
+		h.taskUpdated(r, current, updated)
+	}
+}
+
+// taskUpdated notifies WebSocket clients and the queue about a changed task,
+// audits the change and drops its cached copies.
+func (h *TaskHandler) taskUpdated(r *http.Request, before, updated *models.Task) {
 	h.Hub.Broadcast(realtime.Message{
 		Type: "task_updated",
 		Data: updated,
 	})
 
-	go func() {
-		msg := queue.EventMessage{
-			Type:    queue.EventTaskUpdated,
-			Payload: updated,
-		}
+	h.publish(queue.EventTaskUpdated, updated)
+	auditTask(r, models.AuditTaskUpdated, before, updated)
 
-		body, _ := json.Marshal(msg)
-		err := h.Broker.Publish(body)
-		if err != nil {
+	_ = h.Cache.Delete("tasks:user:" + strconv.Itoa(updated.UserID))
+	_ = h.Cache.Delete("task:" + strconv.Itoa(updated.ID))
+}
+
+// taskFieldErrors validates a whole task the way patches are validated.
+func taskFieldErrors(t *models.Task) []models.FieldError {
+	return models.TaskPatch{Title: &t.Title, Description: &t.Description, Status: &t.Status}.Validate()
+}
+
+// auditTask records the change of a task.
+func auditTask(r *http.Request, action string, before, after *models.Task) {
+	audit.Record(r, audit.TaskEvent(action, before, after))
+}
+
+// publish sends the event to the queue in the background. Failures are only logged.
+func (h *TaskHandler) publish(eventType queue.EventType, payload interface{}) {
+	go func() {
+		if err := h.Broker.PublishEvent(eventType, payload); err != nil {
 			logger.Log.Error("Publish error", zap.Error(err))
 		}
 	}()
+}
 
-	_ = h.Cache.Delete("tasks:user:" + strconv.Itoa(id))
+// ListTrash godoc
+// @Summary      List trashed tasks
+// @Description  Returns deleted tasks of the authenticated user that were not purged yet
+// @Tags         tasks
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.Task
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /trash [get]
+func (h *TaskHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tasks, err := h.Store.ListTrash(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, tasks)
 }
 
-// DeleteTask godoc
-// @Summary      Delete task
-// @Description  Deletes a task by ID for the authenticated user
+// RestoreTask godoc
+// @Summary      Restore task
+// @Description  Takes a deleted task out of the trash
 // @Tags         tasks
+// @Produce      json
 // @Param        id   path      int  true  "Task ID"
 // @Security 	 BearerAuth
-// @Success      204  {string}  string "no content"
+// @Success      200  {object}  models.Task
 // @Failure      400  {string}  string "invalid id"
 // @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found in trash"
+// @Failure      409  {string}  string "WIP limit reached"
 // @Failure      500  {string}  string "internal error"
-// @Router       /tasks/{id} [delete]
-func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
+// @Router       /tasks/{id}/restore [post]
+func (h *TaskHandler) RestoreTask(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(int)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
 
-	if userID != id {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	task, err := h.Store.Restore(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "task not found in trash", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrWIPLimit) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(task))
+	writeJSON(w, http.StatusOK, task)
+
+	h.Hub.Broadcast(realtime.Message{
+		Type: "task_restored",
+		Data: task,
+	})
+	h.publish(queue.EventTaskRestored, task)
+	auditTask(r, models.AuditTaskRestored, nil, task)
+
+	_ = h.Cache.Delete("tasks:user:" + strconv.Itoa(userID))
+}
+
+// DeleteTask godoc
+// @Summary      Delete task
+// @Description  Moves a task to the trash. It can be restored until the retention period ends.
+// @Tags         tasks
+// @Param        id        path    int     true   "Task ID"
+// @Param        If-Match  header  string  false  "ETag of the task version being deleted"
+// @Param        Idempotency-Key  header  string  false  "Unique key to make retries safe"
+// @Security 	 BearerAuth
+// @Success      204  {string}  string "no content"
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      412  {string}  string "task was modified"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id} [delete]
+func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Store)
+	if !ok {
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !taskIfMatch(ifMatch, task) {
+		http.Error(w, "task was modified", http.StatusPreconditionFailed)
 		return
 	}
+	id := task.ID
 
-	err = h.Store.Delete(context.Background(), id)
+	err := h.Store.Delete(context.Background(), id)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "task not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
+	auditTask(r, models.AuditTaskDeleted, task, nil)
 	h.Hub.Broadcast(realtime.Message{
 		Type: "task_deleted",
 		Data: map[string]int{"id": id},
@@ -308,6 +653,30 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	_ = h.Cache.Delete("tasks:user:" + strconv.Itoa(userID))
-	_ = h.Cache.Delete("task:" + idStr)
+	_ = h.Cache.Delete("tasks:user:" + strconv.Itoa(task.UserID))
+	_ = h.Cache.Delete("task:" + strconv.Itoa(id))
+}
+
+// GetTaskPresence godoc
+// @Summary      Get task presence
+// @Description  Returns users that currently have the task open over WebSocket
+// @Tags         tasks
+// @Produce      json
+// @Param        id   path      int  true  "Task ID"
+// @Security 	 BearerAuth
+// @Success      200  {object}  realtime.PresenceChanged
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Router       /tasks/{id}/presence [get]
+func (h *TaskHandler) GetTaskPresence(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Store)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, realtime.PresenceChanged{
+		TaskID:  task.ID,
+		Viewers: h.Hub.Presence(task.ID),
+	})
 }
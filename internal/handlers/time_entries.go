@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/realtime"
+	"GoProjects/TaskTracker/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// maxReportRange bounds the period of a time report.
+const maxReportRange = 366 * 24 * time.Hour
+
+type TimeHandler struct {
+	Tasks *store.TaskStore
+	Store *store.TimeStore
+	Hub   *realtime.Hub
+}
+
+func RegisterTimeRoutes(r chi.Router, tasks *store.TaskStore, s *store.TimeStore, hub *realtime.Hub) {
+	h := &TimeHandler{Tasks: tasks, Store: s, Hub: hub}
+
+	r.Post("/tasks/{id}/timer/start", h.StartTimer)
+	r.Get("/tasks/{id}/time-entries", h.ListTimeEntries)
+	r.Post("/tasks/{id}/time-entries", h.CreateTimeEntry)
+	r.Delete("/tasks/{id}/time-entries/{entryID}", h.DeleteTimeEntry)
+	r.Get("/timer", h.GetTimer)
+	r.Post("/timer/stop", h.StopTimer)
+	r.Get("/reports/time", h.GetTimeReport)
+}
+
+// StartTimer godoc
+// @Summary      Start timer
+// @Description  Starts tracking time on the task. A user can run only one timer at a time.
+// @Tags         time
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                  true   "Task ID"
+// @Param        timer  body      models.TimerRequest  false  "Optional note"
+// @Security 	 BearerAuth
+// @Success      201  {object}  models.TimeEntry
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      409  {string}  string "a timer is already running"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/timer/start [post]
+func (h *TimeHandler) StartTimer(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+
+	var req models.TimerRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if utf8.RuneCountInString(req.Note) > models.MaxTimeEntryNoteLength {
+		http.Error(w, "note must be at most 1000 characters", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.Store.Start(r.Context(), task.ID, task.UserID, req.Note)
+	if err != nil {
+		if errors.Is(err, store.ErrTimerRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, entry)
+	h.Hub.BroadcastTo(entry.UserID, realtime.Message{Type: "timer_started", Data: entry})
+}
+
+// GetTimer godoc
+// @Summary      Get running timer
+// @Tags         time
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.TimeEntry
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "no timer is running"
+// @Failure      500  {string}  string "internal error"
+// @Router       /timer [get]
+func (h *TimeHandler) GetTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	entry, err := h.Store.Running(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "no timer is running", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// StopTimer godoc
+// @Summary      Stop timer
+// @Description  Stops the running timer and returns the finished time entry
+// @Tags         time
+// @Produce      json
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.TimeEntry
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "no timer is running"
+// @Failure      500  {string}  string "internal error"
+// @Router       /timer/stop [post]
+func (h *TimeHandler) StopTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	entry, err := h.Store.Stop(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "no timer is running", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+	h.Hub.BroadcastTo(entry.UserID, realtime.Message{Type: "timer_stopped", Data: entry})
+}
+
+// ListTimeEntries godoc
+// @Summary      List time entries
+// @Description  Returns the time logged on the task, most recent first
+// @Tags         time
+// @Produce      json
+// @Param        id   path      int  true  "Task ID"
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.TimeEntry
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/time-entries [get]
+func (h *TimeHandler) ListTimeEntries(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+	entries, err := h.Store.List(r.Context(), task.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// CreateTimeEntry godoc
+// @Summary      Log time
+// @Description  Logs a finished period of work on the task. Entries may be at most 24 hours long.
+// @Tags         time
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                      true  "Task ID"
+// @Param        entry  body      models.TimeEntryRequest  true  "Time entry"
+// @Security 	 BearerAuth
+// @Success      201  {object}  models.TimeEntry
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "task not found"
+// @Failure      422  {object}  map[string][]models.FieldError
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/time-entries [post]
+func (h *TimeHandler) CreateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+
+	var req models.TimeEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errs := req.Validate(time.Now()); len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string][]models.FieldError{"errors": errs})
+		return
+	}
+
+	entry, err := h.Store.Create(r.Context(), &models.TimeEntry{
+		TaskID:    task.ID,
+		UserID:    task.UserID,
+		StartedAt: req.StartedAt,
+		EndedAt:   &req.EndedAt,
+		Note:      req.Note,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, entry)
+	h.Hub.BroadcastTo(entry.UserID, realtime.Message{Type: "time_entry_added", Data: entry})
+}
+
+// DeleteTimeEntry godoc
+// @Summary      Delete time entry
+// @Description  Deletes a time entry. Deleting the running timer discards it.
+// @Tags         time
+// @Param        id       path  int  true  "Task ID"
+// @Param        entryID  path  int  true  "Time entry ID"
+// @Security 	 BearerAuth
+// @Success      204  {string}  string "no content"
+// @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "time entry not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /tasks/{id}/time-entries/{entryID} [delete]
+func (h *TimeHandler) DeleteTimeEntry(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadOwnedTask(w, r, h.Tasks)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "entryID"))
+	if err != nil {
+		http.Error(w, "invalid time entry id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Store.Delete(r.Context(), task.ID, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "time entry not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	h.Hub.BroadcastTo(task.UserID, realtime.Message{
+		Type: "time_entry_deleted",
+		Data: map[string]int{"id": id, "task_id": task.ID},
+	})
+}
+
+// GetTimeReport godoc
+// @Summary      Time report
+// @Description  Sums up the time logged on the authenticated user's tasks. from and to accept
+// @Description  RFC 3339 timestamps or dates (YYYY-MM-DD, midnight in tz); the period defaults
+// @Description  to the last 30 days and may be at most 366 days long. Running timers count up to now.
+// @Description  Tasks in the trash are left out.
+// @Tags         time
+// @Produce      json
+// @Param        from      query  string  false  "Start of the period, inclusive"
+// @Param        to        query  string  false  "End of the period, exclusive"
+// @Param        group_by  query  string  false  "task (default), user or day"
+// @Param        tz        query  string  false  "IANA time zone for dates and days, default UTC"
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.TimeReport
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /reports/time [get]
+func (h *TimeHandler) GetTimeReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	tz := q.Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		http.Error(w, "unknown time zone "+strconv.Quote(tz), http.StatusBadRequest)
+		return
+	}
+
+	groupBy := q.Get("group_by")
+	switch groupBy {
+	case "":
+		groupBy = models.TimeReportByTask
+	case models.TimeReportByTask, models.TimeReportByUser, models.TimeReportByDay:
+	default:
+		http.Error(w, "group_by must be task, user or day", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now()
+	if raw := q.Get("to"); raw != "" {
+		if to, err = parseReportTime(raw, loc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-30 * 24 * time.Hour)
+	if raw := q.Get("from"); raw != "" {
+		if from, err = parseReportTime(raw, loc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxReportRange {
+		http.Error(w, "the period must be at most 366 days long", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.Store.Report(r.Context(), userID, from, to, groupBy, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report := models.TimeReport{From: from, To: to, GroupBy: groupBy, Timezone: loc.String(), Rows: rows}
+	for _, row := range rows {
+		report.Seconds += row.Seconds
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func parseReportTime(raw string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", raw, loc); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a YYYY-MM-DD date", raw)
+}
@@ -1,197 +1,414 @@
 package handlers
 
 import (
+	"GoProjects/TaskTracker/internal/audit"
 	"GoProjects/TaskTracker/internal/auth"
+	"GoProjects/TaskTracker/internal/logger"
 	"GoProjects/TaskTracker/internal/models"
 	"GoProjects/TaskTracker/internal/store"
-	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
+const maxUserName = 100
+
 type UserHandlers struct {
 	Store *store.UserStore
+	Auth  *AuthHandler
 }
 
-func RegisterUserRoutes(r chi.Router, s *store.UserStore) {
-	h := &UserHandlers{Store: s}
+// RegisterUserRoutes adds the profile of the signed-in user at /me, which works
+// before the email is verified, and the user directory at /users. Both go after
+// AuthMiddleware.
+func RegisterUserRoutes(r chi.Router, authHandler *AuthHandler) {
+	h := &UserHandlers{Store: authHandler.Store, Auth: authHandler}
+
+	r.Get("/me", h.GetProfile)
+	r.Patch("/me", h.UpdateProfile)
+	r.Put("/me/password", h.ChangePassword)
 
-	r.Route("/users", func(r chi.Router) {
-		r.Get("/", h.ListUsers)
-		r.Post("/", h.CreateUser)
+	r.With(RequireVerifiedEmail).Route("/users", func(r chi.Router) {
 		r.Get("/{id}", h.GetUser)
-		r.Put("/{id}", h.UpdateUser)
-		r.Delete("/{id}", h.DeleteUser)
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequireAdmin(h.Store))
+			r.Get("/", h.ListUsers)
+			r.Put("/{id}/role", h.SetRole)
+			r.Delete("/{id}", h.DeleteUser)
+		})
 	})
 }
 
-// ListUsers godoc
-// @Summary      Get all users
-// @Description  Returns list of all users
+// currentUser loads the signed-in user, writing the error response if it fails.
+func (h *UserHandlers) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	user, err := h.Store.Get(r.Context(), userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// GetProfile godoc
+// @Summary      Get own profile
+// @Description  Returns the profile of the authenticated user.
 // @Tags         users
 // @Produce      json
-// @Success      200  {array}  models.User
-// @Failure      500  {string}  string  "internal error"
-// @Router       /users [get]
-func (h *UserHandlers) ListUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.Store.List(context.Background())
+// @Security 	 BearerAuth
+// @Success      200  {object}  models.UserProfile
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      500  {string}  string "internal error"
+// @Router       /me [get]
+func (h *UserHandlers) GetProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, user.Profile())
+}
+
+// UpdateProfile godoc
+// @Summary      Update own profile
+// @Description  Changes the name and email of the authenticated user. A new email needs the
+// @Description  current password, if the account has one, and is sent a link to verify it.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security 	 BearerAuth
+// @Param        request  body      models.UpdateProfileRequest  true  "Fields to change"
+// @Success      200  {object}  models.UserProfile
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "current password is wrong"
+// @Failure      409  {string}  string "email address already in use"
+// @Failure      500  {string}  string "internal error"
+// @Router       /me [patch]
+func (h *UserHandlers) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	var req models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name, email := user.Name, user.Email
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+		if len(name) > maxUserName {
+			http.Error(w, "name has at most "+strconv.Itoa(maxUserName)+" characters", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Email != nil {
+		email = strings.TrimSpace(*req.Email)
+		if email == "" {
+			http.Error(w, "email can't be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	emailChanged := email != user.Email
+	if emailChanged && user.Password != "" && !auth.CheckPassword(user.Password, req.CurrentPassword) {
+		http.Error(w, "current password is wrong", http.StatusForbidden)
+		return
+	}
+
+	updated, err := h.Store.UpdateProfile(r.Context(), user.ID, name, email)
+	if errors.Is(err, store.ErrEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(users)
+	if emailChanged {
+		if err := h.Auth.sendVerification(r.Context(), updated); err != nil {
+			logger.Log.Error("verification mail failed", zap.Int("user_id", updated.ID), zap.Error(err))
+		}
+	}
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditUserUpdated,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(user.ID),
+		Before:     user.Profile(),
+		After:      updated.Profile(),
+	})
+	writeJSON(w, http.StatusOK, updated.Profile())
+}
+
+// ChangePassword godoc
+// @Summary      Change own password
+// @Description  Replaces the password of the authenticated user, given the current one. The
+// @Description  other sessions of the user are signed out and its personal access tokens
+// @Description  revoked. Accounts without a password get one through /auth/password/forgot.
+// @Tags         users
+// @Accept       json
+// @Security 	 BearerAuth
+// @Param        request  body  models.ChangePasswordRequest  true  "Current and new password"
+// @Success      204
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "current password is wrong"
+// @Failure      409  {string}  string "the account has no password"
+// @Failure      500  {string}  string "internal error"
+// @Router       /me/password [put]
+func (h *UserHandlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		http.Error(w, "password must have at least "+strconv.Itoa(minPasswordLength)+" characters", http.StatusBadRequest)
+		return
+	}
+	if user.Password == "" {
+		http.Error(w, "the account has no password, set one through /auth/password/forgot", http.StatusConflict)
+		return
+	}
+	if !auth.CheckPassword(user.Password, req.CurrentPassword) {
+		http.Error(w, "current password is wrong", http.StatusForbidden)
+		return
+	}
+
+	hashed, err := auth.HashPassword(req.NewPassword)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.SetPassword(r.Context(), user.ID, hashed); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	current := 0
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok {
+		current = claims.SessionID
+	}
+	sessions, err := h.Auth.Sessions.RevokeOthers(r.Context(), user.ID, current)
+	if err == nil {
+		err = denySessions(h.Auth.Denylist, sessions)
+	}
+	var tokens int64
+	if err == nil {
+		tokens, err = h.Auth.AccessTokens.RevokeAll(r.Context(), user.ID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditPasswordChange,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(user.ID),
+		After:      map[string]int64{"sessions_revoked": int64(len(sessions)), "access_tokens_revoked": tokens},
+	})
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetUser godoc
 // @Summary      Get user by ID
-// @Description  Returns a single user by their ID
+// @Description  Returns the public profile of a user; admins get the full account.
 // @Tags         users
 // @Produce      json
+// @Security 	 BearerAuth
 // @Param        id   path      int  true  "User ID"
-// @Success      200  {object}  models.User
+// @Success      200  {object}  models.UserPublic
 // @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      404  {string}  string "user not found"
 // @Failure      500  {string}  string "internal error"
 // @Router       /users/{id} [get]
 func (h *UserHandlers) GetUser(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
+	current, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	user, err := h.Store.Get(context.Background(), id)
+	user, err := h.Store.Get(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "user not found", http.StatusNotFound)
-			return
-		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(user)
-	if err != nil {
+
+	if current.Role == models.RoleAdmin {
+		writeJSON(w, http.StatusOK, user.Admin())
 		return
 	}
+	writeJSON(w, http.StatusOK, user.Public())
 }
 
-// CreateUser godoc
-// @Summary      Create user
-// @Description  Create a new user account
+// ListUsers godoc
+// @Summary      Get all users
+// @Description  Returns all user accounts. Admins only.
 // @Tags         users
-// @Accept 		 json
 // @Produce      json
-// @Param        user   body    models.LoginRequest  true  "User info"
-// @Success      201  {object}  models.User
-// @Failure      400  {string}  string "invalid id"
+// @Security 	 BearerAuth
+// @Success      200  {array}   models.UserAdmin
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "admin role required"
 // @Failure      500  {string}  string "internal error"
-// @Router       /users [post]
-func (h *UserHandlers) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var u models.User
-	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// @Router       /users [get]
+func (h *UserHandlers) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.Store.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	views := make([]models.UserAdmin, 0, len(users))
+	for _, u := range users {
+		views = append(views, u.Admin())
+	}
+	writeJSON(w, http.StatusOK, views)
+}
 
-	hashed, err := auth.HashPassword(u.Password)
+// SetRole godoc
+// @Summary      Set user role
+// @Description  Makes a user an admin or a regular user. Admins only; they can't demote
+// @Description  themselves.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security 	 BearerAuth
+// @Param        id       path      int                     true  "User ID"
+// @Param        request  body      models.SetRoleRequest  true  "Role"
+// @Success      200  {object}  models.UserAdmin
+// @Failure      400  {string}  string "invalid input"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "admin role required"
+// @Failure      404  {string}  string "user not found"
+// @Failure      500  {string}  string "internal error"
+// @Router       /users/{id}/role [put]
+func (h *UserHandlers) SetRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "failed to hashed password", http.StatusInternalServerError)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req models.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Role != models.RoleUser && req.Role != models.RoleAdmin {
+		http.Error(w, "role must be user or admin", http.StatusBadRequest)
+		return
+	}
+	if id == r.Context().Value("userID").(int) && req.Role != models.RoleAdmin {
+		http.Error(w, "admins can't demote themselves", http.StatusBadRequest)
 		return
 	}
-	u.Password = hashed
 
-	if err := h.Store.Create(context.Background(), &u); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var user *models.User
+	before, err := h.Store.Get(r.Context(), id)
+	if err == nil {
+		user, err = h.Store.SetRole(r.Context(), id, req.Role)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "user not found", http.StatusNotFound)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(u)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	logger.Log.Info("user role changed", zap.Int("user_id", id), zap.String("role", req.Role),
+		zap.Int("by", r.Context().Value("userID").(int)))
+	if before.Role != user.Role {
+		audit.Record(r, models.AuditEvent{
+			Action:     models.AuditRoleChanged,
+			TargetType: "user",
+			TargetID:   strconv.Itoa(id),
+			Before:     before.Admin(),
+			After:      user.Admin(),
+		})
+	}
+	writeJSON(w, http.StatusOK, user.Admin())
 }
 
 // DeleteUser godoc
 // @Summary      Delete user
-// @Description  Delete a user by ID
+// @Description  Deletes a user account with all its data and signs it out. Admins only; they
+// @Description  can't delete themselves.
 // @Tags         users
-// @Produce      json
+// @Security 	 BearerAuth
 // @Param        id   path      int  true  "User ID"
 // @Success      204  {string}  string "no content"
 // @Failure      400  {string}  string "invalid id"
+// @Failure      401  {string}  string "unauthorized"
+// @Failure      403  {string}  string "admin role required"
+// @Failure      404  {string}  string "user not found"
 // @Failure      500  {string}  string "internal error"
 // @Router       /users/{id} [delete]
 func (h *UserHandlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	err = h.Store.Delete(context.Background(), id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(http.StatusNoContent)
-}
-
-// UpdateUser godoc
-// @Summary      Update user
-// @Description  Updates an existing user
-// @Tags         users
-// @Accept		 json
-// @Produce      json
-// @Param        id   path      int  true  "User ID"
-// @Param        user   body    models.LoginRequest  true  "User info"
-// @Success      200  {object}  models.User
-// @Failure      400  {string}  string "invalid id"
-// @Failure      404  {string}  string "not found"
-// @Failure      500  {string}  string "internal error"
-// @Router       /users/{id} [put]
-func (h *UserHandlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "invalid id", http.StatusBadRequest)
+	if id == r.Context().Value("userID").(int) {
+		http.Error(w, "admins can't delete themselves", http.StatusBadRequest)
 		return
 	}
-	var u models.User
 
-	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	user, err := h.Store.Get(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "user not found", http.StatusNotFound)
 		return
 	}
-	hashed, err := auth.HashPassword(u.Password)
 	if err != nil {
-		http.Error(w, "failed to hashed password", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	u.Password = hashed
 
-	u.ID = id
-	updated, err := h.Store.Update(context.Background(), &u)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			http.Error(w, "user not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// Access tokens outlive the account otherwise.
+	sessions, err := h.Auth.Sessions.RevokeAll(r.Context(), id)
+	if err == nil {
+		err = denySessions(h.Auth.Denylist, sessions)
+	}
+	if err == nil {
+		err = h.Store.Delete(r.Context(), id)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(updated)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	logger.Log.Info("user deleted", zap.Int("user_id", id), zap.Int("by", r.Context().Value("userID").(int)))
+	audit.Record(r, models.AuditEvent{
+		Action:     models.AuditUserDeleted,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(id),
+		Before:     user.Admin(),
+	})
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"GoProjects/TaskTracker/internal/auth"
 	"GoProjects/TaskTracker/internal/logger"
 	"GoProjects/TaskTracker/internal/realtime"
+	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 	"net/http"
+	"strings"
 )
 
 var upgrader = websocket.Upgrader{
@@ -24,7 +27,29 @@ func RegisterWSRoutes(r chi.Router, hub *realtime.Hub) {
 	r.Get("/ws", h.HandleWS)
 }
 
+// HandleWS upgrades the connection. Browsers can't set headers on WebSocket
+// requests, so the JWT may also be passed as the "token" query parameter.
+// Anonymous connections receive broadcasts but neither announce nor see presence.
 func (h *WSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+
+	userID := 0
+	if token != "" {
+		claims, err := auth.ParseToken(token)
+		if errors.Is(err, auth.ErrRevocationUnknown) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		userID = claims.UserID
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Log.Error("ws upgrade failed", zap.Error(err))
@@ -32,7 +57,7 @@ func (h *WSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := realtime.NewClient(h.Hub, conn)
+	client := realtime.NewClient(h.Hub, conn, userID)
 	h.Hub.Register <- client
 
 	go client.WritePump()
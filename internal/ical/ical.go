@@ -0,0 +1,140 @@
+// Package ical renders iCalendar (RFC 5545) feeds.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Component is the kind of calendar component items are rendered as.
+type Component string
+
+const (
+	Event Component = "VEVENT"
+	Todo  Component = "VTODO"
+)
+
+// Status values shared by VEVENT and VTODO. NeedsAction, InProcess and
+// Completed are only valid for VTODO; Confirmed only for VEVENT.
+const (
+	StatusConfirmed   = "CONFIRMED"
+	StatusNeedsAction = "NEEDS-ACTION"
+	StatusInProcess   = "IN-PROCESS"
+	StatusCompleted   = "COMPLETED"
+)
+
+// Item is a single calendar entry. UID must stay the same for the lifetime of
+// the item and Sequence must grow whenever it changes, so that calendar clients
+// update the entry instead of adding a new one.
+type Item struct {
+	UID         string
+	Summary     string
+	Description string
+	Status      string
+	Due         time.Time
+	Sequence    int
+	Created     time.Time
+	Modified    time.Time
+	// Completed is set on finished VTODOs.
+	Completed *time.Time
+}
+
+// Calendar is a feed of items of a single component kind.
+type Calendar struct {
+	Name      string
+	Component Component
+	Items     []Item
+}
+
+const (
+	prodID      = "-//TaskTracker//Tasks//EN"
+	maxLineSize = 75
+	timeLayout  = "20060102T150405Z"
+)
+
+// Write renders the calendar. All times are written in UTC, which every client
+// understands without a VTIMEZONE definition.
+func (c *Calendar) Write(w io.Writer, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", prodID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", Escape(c.Name))
+	}
+	for _, it := range c.Items {
+		line("BEGIN", string(c.Component))
+		line("UID", Escape(it.UID))
+		line("DTSTAMP", FormatTime(now))
+		if !it.Created.IsZero() {
+			line("CREATED", FormatTime(it.Created))
+		}
+		if !it.Modified.IsZero() {
+			line("LAST-MODIFIED", FormatTime(it.Modified))
+		}
+		line("SEQUENCE", strconv.Itoa(it.Sequence))
+		line("SUMMARY", Escape(it.Summary))
+		if it.Description != "" {
+			line("DESCRIPTION", Escape(it.Description))
+		}
+		if c.Component == Todo {
+			line("DUE", FormatTime(it.Due))
+			if it.Completed != nil {
+				line("COMPLETED", FormatTime(*it.Completed))
+			}
+		} else {
+			line("DTSTART", FormatTime(it.Due))
+			line("TRANSP", "TRANSPARENT")
+		}
+		if it.Status != "" {
+			line("STATUS", it.Status)
+		}
+		line("END", string(c.Component))
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// FormatTime formats t as a UTC DATE-TIME value.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// Escape escapes a TEXT property value.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// writeFolded writes a content line, folding it into lines of at most 75 octets
+// without splitting UTF-8 sequences. Continuation lines start with a space.
+func writeFolded(w *bufio.Writer, s string) {
+	limit := maxLineSize
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// the leading space counts towards the next line
+		limit = maxLineSize - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Task fields a column can be mapped to.
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldStatus      = "status"
+)
+
+var csvAliases = map[string]string{
+	"title":       FieldTitle,
+	"name":        FieldTitle,
+	"summary":     FieldTitle,
+	"task":        FieldTitle,
+	"description": FieldDescription,
+	"desc":        FieldDescription,
+	"details":     FieldDescription,
+	"notes":       FieldDescription,
+	"status":      FieldStatus,
+	"state":       FieldStatus,
+}
+
+// jiraAliases match the column names of Jira's "Export CSV (all fields)".
+var jiraAliases = map[string]string{
+	"summary":     FieldTitle,
+	"description": FieldDescription,
+	"status":      FieldStatus,
+}
+
+// CSVImporter reads a CSV file with a header row. Columns are matched to task
+// fields by Aliases (case-insensitive). mapping maps header names to fields
+// explicitly and takes precedence. When a header repeats, the first column wins.
+type CSVImporter struct {
+	Aliases map[string]string
+}
+
+func (c *CSVImporter) Parse(src io.Reader, mapping map[string]string, emit func(Record) error) error {
+	r := csv.NewReader(src)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	columns, err := c.columns(header, mapping)
+	if err != nil {
+		return err
+	}
+
+	for row := 2; ; row++ {
+		values, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+			if err := emit(Record{Row: row, Err: err}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rec := Record{Row: row}
+		get := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(values) {
+				return ""
+			}
+			return strings.TrimSpace(values[i])
+		}
+		rec.Title = get(FieldTitle)
+		rec.Description = get(FieldDescription)
+		rec.Status = NormalizeStatus(get(FieldStatus))
+		if err := emit(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// columns resolves the index of every task field in the header.
+func (c *CSVImporter) columns(header []string, mapping map[string]string) (map[string]int, error) {
+	explicit := make(map[string]string)
+	for column, field := range mapping {
+		switch field {
+		case FieldTitle, FieldDescription, FieldStatus:
+		default:
+			return nil, fmt.Errorf("column %q is mapped to unknown field %q", column, field)
+		}
+		explicit[strings.ToLower(strings.TrimSpace(column))] = field
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		field, ok := explicit[key]
+		if !ok && len(explicit) == 0 {
+			field, ok = c.Aliases[key]
+		}
+		if !ok {
+			continue
+		}
+		if _, seen := columns[field]; !seen {
+			columns[field] = i
+		}
+	}
+
+	if _, ok := columns[FieldTitle]; !ok {
+		return nil, errors.New("no column is mapped to title")
+	}
+	return columns, nil
+}
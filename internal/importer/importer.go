@@ -0,0 +1,85 @@
+// Package importer parses task exports of other trackers into TaskTracker tasks.
+package importer
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Record is a single row of the source file.
+type Record struct {
+	// Row is the 1-based position of the row in the source, used in error reports.
+	Row         int
+	Title       string
+	Description string
+	Status      string
+	// Err is set when the row could not be parsed. The import goes on with the next row.
+	Err error
+}
+
+// Importer parses a source file and calls emit for every row. Parsing stops
+// when emit returns an error. The meaning of mapping is format specific.
+type Importer interface {
+	Parse(src io.Reader, mapping map[string]string, emit func(Record) error) error
+}
+
+var registry = map[string]Importer{}
+
+// Register makes an importer available under the given format identifier.
+func Register(format string, imp Importer) {
+	registry[format] = imp
+}
+
+func Get(format string) (Importer, bool) {
+	imp, ok := registry[format]
+	return imp, ok
+}
+
+// Formats lists the registered format identifiers.
+func Formats() []string {
+	formats := make([]string, 0, len(registry))
+	for f := range registry {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func init() {
+	Register("csv", &CSVImporter{Aliases: csvAliases})
+	Register("jira_csv", &CSVImporter{Aliases: jiraAliases})
+	Register("trello_json", &TrelloImporter{})
+}
+
+var statusAliases = map[string]string{
+	"todo":                     models.StatusTodo,
+	"to_do":                    models.StatusTodo,
+	"open":                     models.StatusTodo,
+	"new":                      models.StatusTodo,
+	"backlog":                  models.StatusTodo,
+	"selected_for_development": models.StatusTodo,
+	"in_progress":              models.StatusInProgress,
+	"doing":                    models.StatusInProgress,
+	"started":                  models.StatusInProgress,
+	"wip":                      models.StatusInProgress,
+	"review":                   models.StatusInProgress,
+	"in_review":                models.StatusInProgress,
+	"done":                     models.StatusDone,
+	"closed":                   models.StatusDone,
+	"resolved":                 models.StatusDone,
+	"complete":                 models.StatusDone,
+	"completed":                models.StatusDone,
+}
+
+// NormalizeStatus maps status names used by other trackers to our statuses.
+// Unknown and empty statuses become todo so that no row is lost.
+func NormalizeStatus(s string) string {
+	key := strings.ToLower(strings.TrimSpace(s))
+	key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+	if status, ok := statusAliases[key]; ok {
+		return status
+	}
+	return models.StatusTodo
+}
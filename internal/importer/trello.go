@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TrelloImporter reads a board exported with Trello's "Export as JSON".
+// The status of a card is derived from the name of its list; mapping maps list
+// names to statuses explicitly. Archived cards are skipped.
+type TrelloImporter struct{}
+
+type trelloBoard struct {
+	Lists []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"lists"`
+	Cards []struct {
+		Name   string `json:"name"`
+		Desc   string `json:"desc"`
+		IDList string `json:"idList"`
+		Closed bool   `json:"closed"`
+	} `json:"cards"`
+}
+
+func (t *TrelloImporter) Parse(src io.Reader, mapping map[string]string, emit func(Record) error) error {
+	var board trelloBoard
+	if err := json.NewDecoder(src).Decode(&board); err != nil {
+		return fmt.Errorf("decode trello board: %w", err)
+	}
+
+	explicit := make(map[string]string)
+	for list, status := range mapping {
+		explicit[strings.ToLower(strings.TrimSpace(list))] = status
+	}
+
+	statuses := make(map[string]string)
+	for _, l := range board.Lists {
+		status, ok := explicit[strings.ToLower(strings.TrimSpace(l.Name))]
+		if !ok {
+			status = l.Name
+		}
+		statuses[l.ID] = NormalizeStatus(status)
+	}
+
+	for i, card := range board.Cards {
+		if card.Closed {
+			continue
+		}
+		rec := Record{
+			Row:         i + 1,
+			Title:       strings.TrimSpace(card.Name),
+			Description: card.Desc,
+			Status:      statuses[card.IDList],
+		}
+		if rec.Status == "" {
+			rec.Status = NormalizeStatus("")
+		}
+		if err := emit(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,7 +11,7 @@ func Init() {
 	var err error
 	Log, err = zap.NewDevelopment()
 	if err != nil {
-		log.Fatal("can't initialize zap logger: %v", err)
+		log.Fatalf("can't initialize zap logger: %v", err)
 	}
 }
 
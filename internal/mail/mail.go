@@ -0,0 +1,114 @@
+// Package mail delivers the emails of the application.
+package mail
+
+import (
+	"GoProjects/TaskTracker/internal/config"
+	"GoProjects/TaskTracker/internal/logger"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv returns the sender selected by MAIL_BACKEND: "smtp" (configured
+// through SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM) or "log",
+// the default, which only logs messages.
+func NewFromEnv() (Sender, error) {
+	switch backend := config.String("MAIL_BACKEND", "log"); backend {
+	case "log":
+		return &LogSender{}, nil
+	case "smtp":
+		s := &SMTPSender{
+			Addr:     config.String("SMTP_ADDR", "localhost:25"),
+			Username: config.String("SMTP_USERNAME", ""),
+			Password: config.String("SMTP_PASSWORD", ""),
+			From:     config.String("MAIL_FROM", "TaskTracker <noreply@localhost>"),
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_BACKEND %q", backend)
+	}
+}
+
+// LogSender is a stand-in for local development and tests: it logs messages
+// and keeps them, so links in them can be followed.
+type LogSender struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	logger.Log.Info("✉ Mail",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body),
+	)
+	s.mu.Lock()
+	s.sent = append(s.sent, msg)
+	s.mu.Unlock()
+	return nil
+}
+
+// Sent returns the messages sent so far.
+func (s *LogSender) Sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.sent...)
+}
+
+// SMTPSender delivers messages through an SMTP server, using STARTTLS when the
+// server offers it.
+type SMTPSender struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("line break in header of mail to %q", msg.To)
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	from := s.From
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		from = strings.TrimSuffix(from[i+1:], ">")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(s.Addr, auth, from, []string{msg.To}, []byte(b.String()))
+}
@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"GoProjects/TaskTracker/internal/logger"
+	"context"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+func TestNewFromEnvDefaultsToLogSender(t *testing.T) {
+	t.Setenv("MAIL_BACKEND", "")
+	s, err := NewFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(*LogSender); !ok {
+		t.Fatalf("NewFromEnv returned %T, want *LogSender", s)
+	}
+
+	t.Setenv("MAIL_BACKEND", "carrier-pigeon")
+	if _, err := NewFromEnv(); err == nil {
+		t.Fatal("NewFromEnv accepted an unknown backend")
+	}
+}
+
+func TestLogSenderKeepsMessages(t *testing.T) {
+	s := &LogSender{}
+	first := Message{To: "ann@example.com", Subject: "Reset your password", Body: "http://localhost/reset?token=a"}
+	second := Message{To: "bob@example.com", Subject: "Verify your email", Body: "http://localhost/verify?token=b"}
+	for _, msg := range []Message{first, second} {
+		if err := s.Send(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent := s.Sent()
+	if len(sent) != 2 || sent[0] != first || sent[1] != second {
+		t.Fatalf("Sent returned %+v", sent)
+	}
+	sent[0].To = "mallory@example.com"
+	if s.Sent()[0] != first {
+		t.Fatal("Sent returned the messages themselves rather than a copy")
+	}
+}
+
+func TestSMTPSenderRejectsHeaderInjection(t *testing.T) {
+	s := &SMTPSender{Addr: "localhost:0", From: "TaskTracker <noreply@localhost>"}
+	msg := Message{To: "ann@example.com\r\nBcc: everyone@example.com", Subject: "Hi", Body: "Hello"}
+	if err := s.Send(context.Background(), msg); err == nil {
+		t.Fatal("Send accepted a line break in the recipient")
+	}
+}
@@ -29,10 +29,47 @@ var (
 			Name: "task_created_total",
 			Help: "Общее количество созданных задач",
 		})
+
+	WSConnectedClients = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ws_connected_clients",
+			Help: "Количество подключенных WebSocket клиентов",
+		})
+
+	WSSlowConsumersDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ws_slow_consumers_dropped_total",
+			Help: "Количество WebSocket клиентов, отключенных из-за переполнения очереди отправки",
+		})
+
+	LoginFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_login_failures_total",
+			Help: "Количество неудачных попыток входа",
+		},
+		[]string{"reason"},
+	)
+
+	LoginLockouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_login_lockouts_total",
+			Help: "Количество временных блокировок входа после неудачных попыток",
+		},
+		[]string{"scope"},
+	)
+
+	WSSendQueueDepth = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "ws_send_queue_depth",
+			Help:    "Глубина очереди отправки WebSocket клиента после постановки сообщения",
+			Buckets: []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, 256},
+		})
 )
 
 func init() {
-	prometheus.MustRegister(HTTPRequests, HTTPDuration, TaskCreated)
+	prometheus.MustRegister(HTTPRequests, HTTPDuration, TaskCreated,
+		WSConnectedClients, WSSlowConsumersDropped, WSSendQueueDepth,
+		LoginFailures, LoginLockouts)
 }
 
 func StatusToString(code int) string {
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Scopes of personal access tokens.
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+)
+
+// Scopes lists the scopes tokens can be granted.
+var Scopes = []string{ScopeTasksRead, ScopeTasksWrite}
+
+// AccessToken is a personal access token. The token itself is only shown once,
+// when it's created.
+type AccessToken struct {
+	ID     int      `json:"id"`
+	UserID int      `json:"-"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is nil for tokens that don't expire.
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// EmailUnverified is set when authenticating while the owner's email address
+	// isn't verified.
+	EmailUnverified bool `json:"-"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AccessTokenCreated is a new token together with its secret.
+type AccessTokenCreated struct {
+	AccessToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audited actions.
+const (
+	AuditLogin           = "auth.login"
+	AuditLoginFailed     = "auth.login_failed"
+	AuditLockout         = "auth.lockout"
+	AuditPasswordReset   = "auth.password_reset"
+	AuditMFAEnabled      = "auth.mfa_enabled"
+	AuditMFADisabled     = "auth.mfa_disabled"
+	AuditTokenCreated    = "access_token.created"
+	AuditTokenRevoked    = "access_token.revoked"
+	AuditUserCreated     = "user.created"
+	AuditUserUpdated     = "user.updated"
+	AuditUserDeleted     = "user.deleted"
+	AuditPasswordChange  = "user.password_changed"
+	AuditRoleChanged     = "user.role_changed"
+	AuditSettingsChanged = "workspace.settings_changed"
+	AuditTaskCreated     = "task.created"
+	AuditTaskUpdated     = "task.updated"
+	AuditTaskDeleted     = "task.deleted"
+	AuditTaskRestored    = "task.restored"
+	AuditTaskPurged      = "task.purged"
+)
+
+// AuditEvent is an action to record. Before and After are the target around
+// the change, nil where it didn't exist.
+type AuditEvent struct {
+	Action     string      `json:"action"`
+	ActorID    *int        `json:"actor_id,omitempty"`
+	IP         string      `json:"ip"`
+	RequestID  string      `json:"request_id"`
+	TargetType string      `json:"target_type"`
+	TargetID   string      `json:"target_id"`
+	Before     interface{} `json:"before,omitempty"`
+	After      interface{} `json:"after,omitempty"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+// AuditEntry is a stored audit event. Diff maps each changed field to its
+// "from" and "to" values. Hash covers the entry and PrevHash, the hash of the
+// entry before.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Action     string          `json:"action"`
+	ActorID    *int            `json:"actor_id,omitempty"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Diff       json.RawMessage `json:"diff" swaggertype:"object"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// AuditVerification is the result of checking the hash chain of the audit log.
+type AuditVerification struct {
+	Valid   bool  `json:"valid"`
+	Checked int64 `json:"checked"`
+	// BrokenAt is the first entry whose hash doesn't match.
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+}
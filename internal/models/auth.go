@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+// TokenResponse is returned by login and refresh.
+type TokenResponse struct {
+	// Token duplicates AccessToken for clients written against the old login response.
+	Token        string `json:"token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken is the stored form of a refresh token; the token itself is only
+// known to the client.
+type RefreshToken struct {
+	ID              int
+	UserID          int
+	FamilyID        string
+	AccessJTI       string
+	AccessExpiresAt *time.Time
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+	UsedAt          *time.Time
+	RevokedAt       *time.Time
+}
+
+// Session is a login on one device. It lives as long as its refresh tokens keep
+// being rotated.
+type Session struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	FamilyID   string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Current marks the session of the token used for the request.
+	Current bool `json:"current"`
+}
+
+type SessionsRevoked struct {
+	Revoked int `json:"revoked"`
+}
+
+// How an external identity was matched to a user on sign-in.
+const (
+	IdentityKnown       = "known"       // signed in before
+	IdentityLinked      = "linked"      // linked to the account with the same email
+	IdentityProvisioned = "provisioned" // a new account was created
+)
+
+// Purposes of the tokens sent by email.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// Scopes of login lockouts.
+const (
+	LockoutAccount = "account"
+	LockoutIP      = "ip"
+	LockoutMFA     = "mfa"
+)
+
+// LoginLockout is the payload of the auth.lockout event, published when failed
+// logins lock an account or an address.
+type LoginLockout struct {
+	Scope    string    `json:"scope"`
+	Email    string    `json:"email,omitempty"`
+	UserID   int       `json:"user_id,omitempty"`
+	IP       string    `json:"ip"`
+	Failures int64     `json:"failures"`
+	Until    time.Time `json:"until"`
+}
@@ -0,0 +1,46 @@
+package models
+
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+const (
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+	BatchOpMove   = "move"
+)
+
+type BatchRequest struct {
+	// Mode is "atomic" (default), applying all operations in one transaction,
+	// or "best_effort", applying each operation on its own.
+	Mode       string           `json:"mode"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchOperation struct {
+	Op string `json:"op"`
+	// ID of the task for update, delete and move.
+	ID int `json:"id,omitempty"`
+	// IfMatch optionally makes the operation conditional on the task ETag.
+	IfMatch string `json:"if_match,omitempty"`
+	// Task holds the fields for create and update. Update only touches present fields.
+	Task *TaskPatch `json:"task,omitempty"`
+	// Status is the target column for move.
+	Status string `json:"status,omitempty"`
+}
+
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	Task   *Task  `json:"task,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode      string        `json:"mode"`
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
@@ -0,0 +1,35 @@
+package models
+
+// Board groups the tasks of a user into one column per status.
+type Board struct {
+	Columns []BoardColumn `json:"columns"`
+}
+
+type BoardColumn struct {
+	Status string `json:"status"`
+	// WIPLimit caps the number of tasks in the column. Nil means no limit.
+	WIPLimit *int    `json:"wip_limit"`
+	Count    int     `json:"count"`
+	Tasks    []*Task `json:"tasks"`
+}
+
+// BoardColumnRequest changes the settings of a column.
+type BoardColumnRequest struct {
+	WIPLimit *int `json:"wip_limit"`
+}
+
+// MoveRequest places a task into the Status column between BeforeID, the task
+// right above it, and AfterID, the task right below it. Either neighbor may be
+// omitted; without both the task goes to the bottom of the column.
+type MoveRequest struct {
+	Status   string `json:"status,omitempty"`
+	BeforeID *int   `json:"before_id,omitempty"`
+	AfterID  *int   `json:"after_id,omitempty"`
+}
+
+// TaskMoved is broadcast when a task is moved on the board.
+type TaskMoved struct {
+	Task     *Task `json:"task"`
+	BeforeID *int  `json:"before_id,omitempty"`
+	AfterID  *int  `json:"after_id,omitempty"`
+}
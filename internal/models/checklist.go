@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MaxChecklistItems      = 100
+	MaxChecklistTextLength = 500
+)
+
+type ChecklistItem struct {
+	ID        int       `json:"id"`
+	TaskID    int       `json:"task_id"`
+	Text      string    `json:"text"`
+	Checked   bool      `json:"checked"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ChecklistProgress counts the checked and total items of a task's checklist.
+type ChecklistProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// ChecklistItemRequest creates or updates an item. On update nil fields are left
+// untouched. Position is zero based; new items are appended when it is omitted.
+type ChecklistItemRequest struct {
+	Text     *string `json:"text,omitempty"`
+	Checked  *bool   `json:"checked,omitempty"`
+	Position *int    `json:"position,omitempty"`
+}
+
+func (r ChecklistItemRequest) Validate() []FieldError {
+	var errs []FieldError
+	if r.Text != nil {
+		switch {
+		case strings.TrimSpace(*r.Text) == "":
+			errs = append(errs, FieldError{Field: "text", Message: "must not be empty"})
+		case utf8.RuneCountInString(*r.Text) > MaxChecklistTextLength:
+			errs = append(errs, FieldError{Field: "text", Message: "must be at most 500 characters"})
+		}
+	}
+	if r.Position != nil && *r.Position < 0 {
+		errs = append(errs, FieldError{Field: "position", Message: "must not be negative"})
+	}
+	return errs
+}
+
+// ChecklistOrder lists all item ids of a checklist in their new order.
+type ChecklistOrder struct {
+	IDs []int `json:"ids"`
+}
+
+// ChecklistChange is broadcast whenever a task's checklist changes.
+type ChecklistChange struct {
+	TaskID   int               `json:"task_id"`
+	Item     *ChecklistItem    `json:"item,omitempty"`
+	Items    []*ChecklistItem  `json:"items,omitempty"`
+	Progress ChecklistProgress `json:"progress"`
+}
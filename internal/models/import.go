@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// MaxImportErrors caps the per-row error report of an import.
+const MaxImportErrors = 1000
+
+type Import struct {
+	ID            int               `json:"id"`
+	UserID        int               `json:"user_id"`
+	Format        string            `json:"format"`
+	Filename      string            `json:"filename"`
+	Mapping       map[string]string `json:"mapping,omitempty"`
+	Status        string            `json:"status"`
+	TotalRows     int               `json:"total_rows"`
+	ProcessedRows int               `json:"processed_rows"`
+	CreatedRows   int               `json:"created_rows"`
+	FailedRows    int               `json:"failed_rows"`
+	Errors        []ImportRowError  `json:"errors"`
+	Error         string            `json:"error,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	StartedAt     *time.Time        `json:"started_at,omitempty"`
+	FinishedAt    *time.Time        `json:"finished_at,omitempty"`
+}
+
+// ImportRowError explains why a row of the source file was not imported.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// MFA is the TOTP enrollment of a user.
+type MFA struct {
+	UserID      int
+	Secret      string
+	EnabledAt   *time.Time
+	LastCounter int64
+	CreatedAt   time.Time
+}
+
+// MFAChallenge is returned by login instead of tokens when a second factor is
+// needed. With EnrollmentRequired the user must set up 2FA first.
+type MFAChallenge struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	MFAToken           string `json:"mfa_token"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+// MFAVerifyRequest completes a login with a TOTP code or a recovery code.
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// MFAEnrollRequest starts the enrollment. Users who are signed in send their
+// access token instead of an MFA token.
+type MFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token,omitempty"`
+}
+
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type MFAEnableRequest struct {
+	MFAToken string `json:"mfa_token,omitempty"`
+	Code     string `json:"code"`
+}
+
+// MFAEnabled carries the recovery codes, shown only once, and the tokens of the
+// login when the enrollment completed one.
+type MFAEnabled struct {
+	RecoveryCodes []string       `json:"recovery_codes"`
+	Tokens        *TokenResponse `json:"tokens,omitempty"`
+}
+
+type MFADisableRequest struct {
+	Code string `json:"code"`
+}
+
+type MFAStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// FieldChange is a single field modified by a revision.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// TaskSnapshot holds the editable task fields as of a revision.
+type TaskSnapshot struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+}
+
+// TaskRevision is an entry of the append-only task history.
+// Revision matches the task version it produced.
+type TaskRevision struct {
+	TaskID    int           `json:"task_id"`
+	Revision  int           `json:"revision"`
+	ActorID   *int          `json:"actor_id"`
+	Changes   []FieldChange `json:"changes"`
+	Snapshot  TaskSnapshot  `json:"snapshot"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+func (s TaskSnapshot) Patch() TaskPatch {
+	return TaskPatch{
+		Title:       &s.Title,
+		Description: &s.Description,
+		Status:      &s.Status,
+		DueAt:       OptionalTime{Set: true, Time: s.DueAt},
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// WorkspaceSettings are the policies admins set for everybody.
+type WorkspaceSettings struct {
+	// MFARequired makes every user set up two-factor authentication at the next
+	// login and keeps them from turning it off.
+	MFARequired bool `json:"mfa_required"`
+	// MFARequiredByConfig tells that MFA_REQUIRED requires 2FA whatever the
+	// setting above says.
+	MFARequiredByConfig bool      `json:"mfa_required_by_config"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	UpdatedBy           *int      `json:"updated_by,omitempty"`
+}
+
+// UpdateWorkspaceSettingsRequest changes the settings given.
+type UpdateWorkspaceSettingsRequest struct {
+	MFARequired *bool `json:"mfa_required"`
+}
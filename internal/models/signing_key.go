@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// SigningKey is a stored key pair for signing access tokens.
+type SigningKey struct {
+	KID       string
+	Algorithm string
+	// PrivateKey is PKCS #8, encrypted with the key encryption key if Encrypted.
+	PrivateKey  []byte
+	PublicKey   []byte
+	Encrypted   bool
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	ExpiresAt   *time.Time
+}
+
+// JSONWebKey is the public part of a signing key as described in RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// curve and public key of OKP (Ed25519) and EC keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
@@ -1,19 +1,118 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 type Task struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	UserID      int       `json:"user_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	UserID      int        `json:"user_id"`
+	Version     int        `json:"version"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	// Rank orders the task within its status column on the board.
+	Rank string `json:"rank"`
+	// Checklist is derived from the task's checklist items and is read-only.
+	Checklist ChecklistProgress `json:"checklist"`
 }
 
 type TaskRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Status      string `json:"status"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+}
+
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusDone       = "done"
+)
+
+// TaskStatuses lists the statuses a task can be in.
+var TaskStatuses = []string{StatusTodo, StatusInProgress, StatusDone}
+
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 10000
+)
+
+// TaskPatch is a partial task update. Nil fields are left untouched.
+type TaskPatch struct {
+	Title       *string      `json:"title,omitempty"`
+	Description *string      `json:"description,omitempty"`
+	Status      *string      `json:"status,omitempty"`
+	DueAt       OptionalTime `json:"due_at" swaggertype:"string" format:"date-time"`
+}
+
+// OptionalTime is a patch value for a nullable timestamp. Set reports whether
+// the field was present at all; a present null clears the timestamp.
+type OptionalTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+func (o *OptionalTime) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	o.Time = nil
+	if string(data) == "null" {
+		return nil
+	}
+	var t time.Time
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	o.Time = &t
+	return nil
+}
+
+func (o OptionalTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.Time)
+}
+
+// FieldError describes why a single field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (p TaskPatch) IsEmpty() bool {
+	return p.Title == nil && p.Description == nil && p.Status == nil && !p.DueAt.Set
+}
+
+// Validate checks every field present in the patch.
+func (p TaskPatch) Validate() []FieldError {
+	var errs []FieldError
+	if p.Title != nil {
+		switch {
+		case strings.TrimSpace(*p.Title) == "":
+			errs = append(errs, FieldError{Field: "title", Message: "must not be empty"})
+		case utf8.RuneCountInString(*p.Title) > MaxTitleLength:
+			errs = append(errs, FieldError{Field: "title", Message: "must be at most 200 characters"})
+		}
+	}
+	if p.Description != nil && utf8.RuneCountInString(*p.Description) > MaxDescriptionLength {
+		errs = append(errs, FieldError{Field: "description", Message: "must be at most 10000 characters"})
+	}
+	if p.Status != nil && !IsValidStatus(*p.Status) {
+		errs = append(errs, FieldError{Field: "status", Message: "must be one of " + strings.Join(TaskStatuses, ", ")})
+	}
+	return errs
+}
+
+func IsValidStatus(status string) bool {
+	for _, s := range TaskStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MaxTimeEntryNoteLength = 1000
+	// MaxTimeEntryDuration caps manually logged entries.
+	MaxTimeEntryDuration = 24 * time.Hour
+)
+
+// TimeEntry is a span of time a user spent on a task. EndedAt is nil while the
+// entry is a running timer.
+type TimeEntry struct {
+	ID        int        `json:"id"`
+	TaskID    int        `json:"task_id"`
+	UserID    int        `json:"user_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Note      string     `json:"note"`
+	// Seconds is the length of the entry, up to now for a running timer.
+	Seconds   int64     `json:"seconds"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TimerRequest starts a timer.
+type TimerRequest struct {
+	Note string `json:"note"`
+}
+
+// TimeEntryRequest logs time manually.
+type TimeEntryRequest struct {
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Note      string    `json:"note"`
+}
+
+func (r TimeEntryRequest) Validate(now time.Time) []FieldError {
+	var errs []FieldError
+	switch {
+	case r.StartedAt.IsZero():
+		errs = append(errs, FieldError{Field: "started_at", Message: "is required"})
+	case r.StartedAt.After(now):
+		errs = append(errs, FieldError{Field: "started_at", Message: "must not be in the future"})
+	}
+	switch {
+	case r.EndedAt.IsZero():
+		errs = append(errs, FieldError{Field: "ended_at", Message: "is required"})
+	case !r.EndedAt.After(r.StartedAt):
+		errs = append(errs, FieldError{Field: "ended_at", Message: "must be after started_at"})
+	case r.EndedAt.After(now):
+		errs = append(errs, FieldError{Field: "ended_at", Message: "must not be in the future"})
+	case r.EndedAt.Sub(r.StartedAt) > MaxTimeEntryDuration:
+		errs = append(errs, FieldError{Field: "ended_at", Message: "entries must be at most 24 hours long"})
+	}
+	if utf8.RuneCountInString(r.Note) > MaxTimeEntryNoteLength {
+		errs = append(errs, FieldError{Field: "note", Message: "must be at most 1000 characters"})
+	}
+	return errs
+}
+
+const (
+	TimeReportByTask = "task"
+	TimeReportByUser = "user"
+	TimeReportByDay  = "day"
+)
+
+// TimeReport sums up the time logged between From and To. Entries crossing the
+// bounds, or a day boundary when grouping by day, are split.
+type TimeReport struct {
+	From     time.Time       `json:"from"`
+	To       time.Time       `json:"to"`
+	GroupBy  string          `json:"group_by"`
+	Timezone string          `json:"timezone"`
+	Rows     []TimeReportRow `json:"rows"`
+	Seconds  int64           `json:"seconds"`
+}
+
+// TimeReportRow is one group of a TimeReport. Key is the task id, the user id or
+// the date (YYYY-MM-DD) depending on the grouping; Label is a readable name.
+type TimeReportRow struct {
+	Key     string  `json:"key"`
+	Label   string  `json:"label,omitempty"`
+	Seconds int64   `json:"seconds"`
+	Hours   float64 `json:"hours"`
+}
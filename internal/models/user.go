@@ -2,14 +2,92 @@ package models
 
 import "time"
 
+// Roles of users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User is the stored account. It's never sent as is; see UserPublic,
+// UserProfile and UserAdmin.
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	// Password is the bcrypt hash, empty for users signing in elsewhere.
+	Password  string    `json:"-"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
+	// EmailVerifiedAt is set once the user confirmed the email address.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// UserPublic is what other users see of a user.
+type UserPublic struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserProfile is what users see of themselves.
+type UserProfile struct {
+	ID            int       `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	EmailVerified bool      `json:"email_verified"`
+	HasPassword   bool      `json:"has_password"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// UserAdmin is what admins see of a user.
+type UserAdmin struct {
+	UserProfile
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+func (u *User) Public() UserPublic {
+	return UserPublic{ID: u.ID, Name: u.Name}
+}
+
+func (u *User) Profile() UserProfile {
+	return UserProfile{
+		ID:            u.ID,
+		Email:         u.Email,
+		Name:          u.Name,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		HasPassword:   u.Password != "",
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+func (u *User) Admin() UserAdmin {
+	return UserAdmin{UserProfile: u.Profile(), Role: u.Role, EmailVerifiedAt: u.EmailVerifiedAt}
+}
+
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+// UpdateProfileRequest changes the fields given. A new email needs the current
+// password, if the account has one, and has to be verified again.
+type UpdateProfileRequest struct {
+	Name            *string `json:"name,omitempty"`
+	Email           *string `json:"email,omitempty"`
+	CurrentPassword string  `json:"current_password,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
@@ -0,0 +1,334 @@
+// Package mockidp is a minimal OpenID Connect provider for trying out single
+// sign-on locally. It signs in whoever enters an email address, so never expose it.
+package mockidp
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"html/template"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const codeTTL = time.Minute
+
+// Provider is a minimal OpenID Connect provider that signs in whoever enters an
+// email address, for trying out single sign-on locally and in tests.
+type Provider struct {
+	issuer       string
+	publicURL    string
+	clientID     string
+	clientSecret string
+	redirectURIs []string
+
+	key *rsa.PrivateKey
+	kid string
+
+	mu    sync.Mutex
+	codes map[string]*grant
+}
+
+// grant is what an authorization code stands for until it's redeemed.
+type grant struct {
+	redirectURI   string
+	challenge     string
+	nonce         string
+	email         string
+	name          string
+	emailVerified bool
+	expiresAt     time.Time
+}
+
+// Config configures the provider.
+type Config struct {
+	Issuer string
+	// PublicURL is where browsers reach the provider, if not at Issuer.
+	PublicURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURIs []string
+}
+
+// New returns a provider with a fresh signing key.
+func New(cfg Config) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+	publicURL := strings.TrimSuffix(cfg.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = issuer
+	}
+	return &Provider{
+		issuer:       issuer,
+		publicURL:    publicURL,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		redirectURIs: cfg.RedirectURIs,
+		key:          key,
+		kid:          "mock-1",
+		codes:        make(map[string]*grant),
+	}, nil
+}
+
+// Handler serves discovery, the JWKS and the authorization and token endpoints.
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorizeForm)
+	mux.HandleFunc("POST /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	return mux
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.publicURL + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, models.JSONWebKeySet{Keys: []models.JSONWebKey{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		KeyID:     p.kid,
+		Algorithm: "RS256",
+		N:         base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<title>Mock identity provider</title>
+<h1>Sign in</h1>
+<form method="post" action="authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><label>Email <input name="email" type="email" value="{{.Email}}" required autofocus></label>
+<p><label>Name <input name="name"></label>
+<p><label><input name="email_verified" type="checkbox" value="true" checked> Email verified</label>
+<p><button>Sign in</button>
+</form>`))
+
+// authorizeForm asks for the identity to sign in as.
+func (p *Provider) authorizeForm(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if msg := p.checkAuthorizeRequest(q); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	params := map[string]string{}
+	for _, name := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge", "code_challenge_method"} {
+		params[name] = q.Get(name)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = loginPage.Execute(w, map[string]interface{}{"Params": params, "Email": q.Get("login_hint")})
+}
+
+func (p *Provider) checkAuthorizeRequest(q url.Values) string {
+	if q.Get("client_id") != p.clientID {
+		return "unknown client_id"
+	}
+	if !p.allowedRedirect(q.Get("redirect_uri")) {
+		return "redirect_uri not registered"
+	}
+	if rt := q.Get("response_type"); rt != "" && rt != "code" {
+		return "only response_type=code is supported"
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		return "PKCE with S256 is required"
+	}
+	return ""
+}
+
+func (p *Provider) allowedRedirect(uri string) bool {
+	for _, allowed := range p.redirectURIs {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize signs in as the entered identity and redirects back with a code.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := p.checkAuthorizeRequest(r.PostForm); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(r.PostForm.Get("email"))
+	if email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString(24)
+	p.mu.Lock()
+	for c, g := range p.codes {
+		if time.Now().After(g.expiresAt) {
+			delete(p.codes, c)
+		}
+	}
+	p.codes[code] = &grant{
+		redirectURI:   r.PostForm.Get("redirect_uri"),
+		challenge:     r.PostForm.Get("code_challenge"),
+		nonce:         r.PostForm.Get("nonce"),
+		email:         email,
+		name:          r.PostForm.Get("name"),
+		emailVerified: r.PostForm.Get("email_verified") == "true",
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	target, _ := url.Parse(r.PostForm.Get("redirect_uri"))
+	q := target.Query()
+	q.Set("code", code)
+	if state := r.PostForm.Get("state"); state != "" {
+		q.Set("state", state)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token redeems an authorization code for an ID token.
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(p.clientSecret)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mockidp"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !ok || time.Now().After(g.expiresAt) || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(w, "invalid_grant", "code_verifier doesn't match the code_challenge")
+		return
+	}
+
+	now := time.Now()
+	subject := sha256.Sum256([]byte(strings.ToLower(g.email)))
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            hex.EncodeToString(subject[:8]),
+		"aud":            p.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": g.emailVerified,
+		"name":           g.name,
+	})
+	token.Header["kid"] = p.kid
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(24),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// SignIn submits the login form for the authorization request authURL as the
+// given identity, like a browser would, and returns the URL the provider
+// redirects back to, with the code and state.
+func SignIn(client *http.Client, authURL, email string, emailVerified bool) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	form := u.Query()
+	form.Set("email", email)
+	if emailVerified {
+		form.Set("email_verified", "true")
+	}
+	u.RawQuery = ""
+
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := noRedirect.PostForm(u.String(), form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("mockidp sign-in: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Header.Get("Location"), nil
+}
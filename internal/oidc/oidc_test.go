@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"GoProjects/TaskTracker/internal/oidc/mockidp"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testRedirectURL = "http://app.test/auth/oidc/callback"
+
+// newTestProvider starts the mock IdP and discovers it.
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+	var idp http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	mock, err := mockidp.New(mockidp.Config{
+		Issuer:       srv.URL,
+		ClientID:     "tasktracker",
+		ClientSecret: "tasktracker-secret",
+		RedirectURIs: []string{testRedirectURL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp = mock.Handler()
+
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:       srv.URL,
+		ClientID:     "tasktracker",
+		ClientSecret: "tasktracker-secret",
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	return p
+}
+
+// signIn starts a login and returns the authorization code the IdP sends back.
+func signIn(t *testing.T, p *Provider, email, nonce, verifier string) string {
+	t.Helper()
+	redirect, err := mockidp.SignIn(http.DefaultClient, p.AuthCodeURL("state-1", nonce, verifier), email, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("state"); got != "state-1" {
+		t.Fatalf("state %q came back as %q", "state-1", got)
+	}
+	return u.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	p := newTestProvider(t)
+	verifier, _ := NewVerifier()
+	code := signIn(t, p, "Ann@Example.com", "nonce-1", verifier)
+
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Email != "Ann@Example.com" || !claims.EmailVerified || claims.Subject == "" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); err == nil {
+		t.Fatal("a code was redeemed twice")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	p := newTestProvider(t)
+	verifier, _ := NewVerifier()
+	other, _ := NewVerifier()
+	code := signIn(t, p, "ann@example.com", "nonce-1", verifier)
+
+	if _, err := p.Exchange(context.Background(), code, other, "nonce-1"); err == nil {
+		t.Fatal("Exchange accepted a code verifier that doesn't match the challenge")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	p := newTestProvider(t)
+	verifier, _ := NewVerifier()
+	code := signIn(t, p, "ann@example.com", "nonce-1", verifier)
+
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-2"); err == nil {
+		t.Fatal("Exchange accepted an ID token issued for another login")
+	}
+}
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"GoProjects/TaskTracker/internal/logger"
+	"encoding/json"
 	"github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
 	"time"
@@ -11,14 +12,33 @@ type Broker struct {
 	conn    *amqp091.Connection
 	channel *amqp091.Channel
 	queue   amqp091.Queue
+	// exchange is set for fanout brokers, which publish to it instead of a queue.
+	exchange string
 }
 
 type EventType string
 
 const (
-	EventTaskCreated EventType = "task.created"
-	EventTaskUpdated EventType = "task.updated"
-	EventTaskDeleted EventType = "task.deleted"
+	EventTaskCreated  EventType = "task.created"
+	EventTaskUpdated  EventType = "task.updated"
+	EventTaskDeleted  EventType = "task.deleted"
+	EventTaskRestored EventType = "task.restored"
+	EventTaskPurged   EventType = "task.purged"
+	EventTaskBatch    EventType = "task.batch"
+	EventTaskMoved    EventType = "task.moved"
+
+	EventImportRequested EventType = "import.requested"
+	EventImportFinished  EventType = "import.finished"
+
+	EventMailRequested EventType = "mail.requested"
+	EventAuthLockout   EventType = "auth.lockout"
+
+	// EventAuditRecorded goes to the audit queue only.
+	EventAuditRecorded EventType = "audit.recorded"
+
+	// EventRealtime carries a realtime.Delivery from the worker to every
+	// server, which sends it to the WebSocket clients of its user.
+	EventRealtime EventType = "realtime"
 )
 
 type EventMessage struct {
@@ -27,6 +47,36 @@ type EventMessage struct {
 }
 
 func NewBroker(url, queueName string) (*Broker, error) {
+	conn, ch, err := dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := ch.QueueDeclare(queueName, true, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Broker{conn: conn, channel: ch, queue: q}, nil
+}
+
+// NewFanoutBroker publishes to the fanout exchange of the given name, which
+// hands every message to all queues bound to it. Consume binds a queue of its
+// own, so that every consumer receives every message.
+func NewFanoutBroker(url, exchange string) (*Broker, error) {
+	conn, ch, err := dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.ExchangeDeclare(exchange, "fanout", true, false, false, false, nil); err != nil {
+		return nil, err
+	}
+
+	return &Broker{conn: conn, channel: ch, exchange: exchange}, nil
+}
+
+func dial(url string) (*amqp091.Connection, *amqp091.Channel, error) {
 	var err error
 	var conn *amqp091.Connection
 
@@ -40,36 +90,51 @@ func NewBroker(url, queueName string) (*Broker, error) {
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
-		return nil, err
-	}
-
-	q, err := ch.QueueDeclare(queueName, true, false, false, false, nil)
-	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	return &Broker{conn: conn, channel: ch, queue: q}, nil
+	return conn, ch, nil
 }
 
 func (b *Broker) Publish(body []byte) error {
 	return b.channel.Publish(
-		"",
+		b.exchange,
 		b.queue.Name,
 		false,
 		false,
 		amqp091.Publishing{
-			ContentType: "application/json",
-			Body:        body,
+			ContentType:  "application/json",
+			DeliveryMode: amqp091.Persistent,
+			Body:         body,
 		},
 	)
 }
 
+// PublishEvent wraps the payload into an EventMessage and publishes it.
+func (b *Broker) PublishEvent(eventType EventType, payload interface{}) error {
+	body, err := json.Marshal(EventMessage{Type: eventType, Payload: payload})
+	if err != nil {
+		return err
+	}
+	return b.Publish(body)
+}
+
 func (b *Broker) Consume() (<-chan amqp091.Delivery, error) {
+	if b.exchange != "" {
+		// The queue lives as long as the connection and gets every message.
+		q, err := b.channel.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.channel.QueueBind(q.Name, "", b.exchange, false, nil); err != nil {
+			return nil, err
+		}
+		b.queue = q
+	}
 	return b.channel.Consume(
 		b.queue.Name,
 		"",
@@ -0,0 +1,78 @@
+// Package rank generates lexicographically ordered keys for manually sorted lists.
+//
+// A rank is a base-62 fraction written without the leading "0.": "V" sorts between
+// "1" and "k" just like 0.V sits between 0.1 and 0.k. A new key can always be found
+// between two different keys, so moving an item only rewrites that item's rank.
+// Ranks never end in the lowest digit, otherwise "1" and "10" would be equal.
+package rank
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const base = len(digits)
+
+// ErrInvalidRange is returned by Between when there is no key between its arguments.
+var ErrInvalidRange = errors.New("rank: no key between bounds")
+
+// Between returns a rank that sorts after a and before b. An empty a means the
+// start of the list and an empty b its end.
+func Between(a, b string) (string, error) {
+	if err := validate(a); err != nil {
+		return "", err
+	}
+	if err := validate(b); err != nil {
+		return "", err
+	}
+	if b != "" && a >= b {
+		return "", ErrInvalidRange
+	}
+
+	var out strings.Builder
+	upper := b != ""
+	for i := 0; ; i++ {
+		lo := 0
+		if i < len(a) {
+			lo = strings.IndexByte(digits, a[i])
+		}
+		hi := base
+		if upper {
+			hi = 0
+			if i < len(b) {
+				hi = strings.IndexByte(digits, b[i])
+			}
+		}
+
+		if hi-lo > 1 {
+			out.WriteByte(digits[(lo+hi)/2])
+			return out.String(), nil
+		}
+		// No room at this position: keep a's digit and look further. Once it is
+		// below b's digit, everything that follows sorts before b.
+		out.WriteByte(digits[lo])
+		if hi-lo == 1 {
+			upper = false
+		}
+	}
+}
+
+// Nth returns evenly spaced ranks for rebuilding a whole list: Nth(0) < Nth(1) < ...
+func Nth(i int) string {
+	return fmt.Sprintf("%010dV", i+1)
+}
+
+func validate(r string) error {
+	for i := 0; i < len(r); i++ {
+		if strings.IndexByte(digits, r[i]) < 0 {
+			return fmt.Errorf("rank: invalid character %q in %q", r[i], r)
+		}
+	}
+	if strings.HasSuffix(r, digits[:1]) {
+		return fmt.Errorf("rank: %q ends in %q", r, digits[:1])
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package rank
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// checkBetween fails unless Between(a, b) returns a valid key that sorts
+// after a and, for a non-empty b, before b.
+func checkBetween(t *testing.T, a, b string) string {
+	t.Helper()
+	r, err := Between(a, b)
+	if err != nil {
+		t.Fatalf("Between(%q, %q): %v", a, b, err)
+	}
+	if err := validate(r); err != nil {
+		t.Fatalf("Between(%q, %q) = %q, which is invalid: %v", a, b, r, err)
+	}
+	if r <= a || (b != "" && r >= b) {
+		t.Fatalf("Between(%q, %q) = %q, which doesn't sort between them", a, b, r)
+	}
+	return r
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"empty list", "", "", "V"},
+		{"room in the first digit", "1", "k", "N"},
+		{"adjacent keys", "1", "2", "1V"},
+		{"adjacent keys of different lengths", "1z", "2", "1zV"},
+		{"before the lowest key", "", "1", "0V"},
+		{"before a key starting with the lowest digit", "", "01", "00V"},
+		{"after the highest key", "z", "", "zV"},
+		{"after a run of the highest digit", "zzz", "", "zzzV"},
+		{"before any key", "", "V", "F"},
+		{"after any key", "V", "", "k"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkBetween(t, tt.a, tt.b); got != tt.want {
+				t.Errorf("Between(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBetweenRejectsEmptyRange(t *testing.T) {
+	for _, pair := range [][2]string{{"V", "V"}, {"k", "1"}, {"1V", "1"}, {"z", "z"}} {
+		if _, err := Between(pair[0], pair[1]); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("Between(%q, %q) returned %v, want ErrInvalidRange", pair[0], pair[1], err)
+		}
+	}
+}
+
+func TestBetweenRejectsInvalidKeys(t *testing.T) {
+	for _, pair := range [][2]string{{"a-b", ""}, {"", "ä"}, {"1 ", "2"}, {"10", ""}, {"", "V0"}} {
+		_, err := Between(pair[0], pair[1])
+		if err == nil || errors.Is(err, ErrInvalidRange) {
+			t.Errorf("Between(%q, %q) returned %v, want an invalid key error", pair[0], pair[1], err)
+		}
+	}
+}
+
+func TestBetweenRepeatedly(t *testing.T) {
+	// Inserting again and again at the same place must keep finding keys.
+	lo, hi := "1", "2"
+	for i := 0; i < 200; i++ {
+		lo = checkBetween(t, lo, hi)
+	}
+	lo, hi = "1", "2"
+	for i := 0; i < 200; i++ {
+		hi = checkBetween(t, lo, hi)
+	}
+	first := ""
+	for i := 0; i < 200; i++ {
+		first = checkBetween(t, "", first+"1")
+	}
+}
+
+// randomKey returns a valid key of up to six digits.
+func randomKey(rng *rand.Rand) string {
+	key := make([]byte, 1+rng.Intn(6))
+	for i := range key {
+		key[i] = digits[rng.Intn(base)]
+	}
+	if key[len(key)-1] == digits[0] {
+		key[len(key)-1] = digits[1+rng.Intn(base-1)]
+	}
+	return string(key)
+}
+
+func TestBetweenSortsBetweenRandomKeys(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		a, b := randomKey(rng), randomKey(rng)
+		if a == b {
+			continue
+		}
+		if a > b {
+			a, b = b, a
+		}
+		checkBetween(t, a, b)
+		checkBetween(t, "", a)
+		checkBetween(t, b, "")
+	}
+}
+
+func TestNth(t *testing.T) {
+	prev := ""
+	for _, i := range []int{0, 1, 2, 8, 9, 10, 11, 99, 100, 101, 999, 1000, 123456} {
+		r := Nth(i)
+		if err := validate(r); err != nil {
+			t.Fatalf("Nth(%d) = %q, which is invalid: %v", i, r, err)
+		}
+		if r <= prev {
+			t.Fatalf("Nth(%d) = %q doesn't sort after %q", i, r, prev)
+		}
+		prev = r
+	}
+	for i := 0; i < 5000; i++ {
+		if Nth(i) >= Nth(i+1) {
+			t.Fatalf("Nth(%d) = %q doesn't sort before Nth(%d) = %q", i, Nth(i), i+1, Nth(i+1))
+		}
+	}
+	// Rebuilt lists leave room for moves between neighbors.
+	checkBetween(t, Nth(0), Nth(1))
+	checkBetween(t, "", Nth(0))
+}
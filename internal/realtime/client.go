@@ -1,40 +1,123 @@
 package realtime
 
-import "github.com/gorilla/websocket"
+import (
+	"GoProjects/TaskTracker/internal/logger"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"time"
+)
 
-func NewClient(h *Hub, conn *websocket.Conn) *Client {
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte
+	// userID is the authenticated user, 0 for anonymous connections.
+	userID int
+
+	// closeCode and closeReason are set by the hub before it closes send,
+	// so WritePump can tell the peer why the connection is going away.
+	closeCode   int
+	closeReason string
+}
+
+// inboundMessage is a message sent by the client, e.g.
+//
+//	{"type": "presence", "data": {"task_id": 5, "state": "editing"}}
+type inboundMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type presenceAnnouncement struct {
+	TaskID int           `json:"task_id"`
+	State  PresenceState `json:"state"`
+}
+
+func NewClient(h *Hub, conn *websocket.Conn, userID int) *Client {
 	return &Client{
-		hub:  h,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:       h,
+		conn:      conn,
+		userID:    userID,
+		send:      make(chan []byte, h.cfg.SendBuffer),
+		closeCode: websocket.CloseNormalClosure,
 	}
 }
 
+// disconnect closes the send channel with the given close frame code and reason.
+// Must only be called from the hub goroutine.
+func (c *Client) disconnect(code int, reason string) {
+	c.closeCode = code
+	c.closeReason = reason
+	close(c.send)
+}
+
 func (c *Client) ReadPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
+
+	c.conn.SetReadLimit(c.hub.cfg.MaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(c.hub.cfg.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.hub.cfg.PongWait))
+	})
+
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logger.Log.Warn("ws read error", zap.Error(err))
+			}
 			break
 		}
+		c.handleMessage(data)
+	}
+}
+
+func (c *Client) handleMessage(data []byte) {
+	var msg inboundMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+
+	switch msg.Type {
+	case "presence":
+		if c.userID == 0 {
+			return
+		}
+		var a presenceAnnouncement
+		if err := json.Unmarshal(msg.Data, &a); err != nil {
+			return
+		}
+		c.hub.announce(c, a.TaskID, a.State)
 	}
 }
 
 func (c *Client) WritePump() {
+	ticker := time.NewTicker(c.hub.cfg.PingPeriod)
 	defer func() {
+		ticker.Stop()
 		c.conn.Close()
 	}()
 	for {
 		select {
 		case msg, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMsg := websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+				_ = c.conn.WriteMessage(websocket.CloseMessage, closeMsg)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
-			c.conn.WriteMessage(websocket.TextMessage, msg)
 		}
 	}
 }
@@ -0,0 +1,56 @@
+package realtime
+
+import "time"
+
+// Config controls keepalive, deadlines and buffering of WebSocket clients.
+type Config struct {
+	// WriteWait is the time allowed to write a single message to the peer.
+	WriteWait time.Duration
+	// PongWait is the time allowed to read the next pong from the peer.
+	PongWait time.Duration
+	// PingPeriod is how often pings are sent. Must be less than PongWait.
+	PingPeriod time.Duration
+	// MaxMessageSize is the maximum size in bytes of a message read from the peer.
+	MaxMessageSize int64
+	// SendBuffer is the number of outgoing messages queued per client before
+	// it is considered a slow consumer and disconnected.
+	SendBuffer int
+	// PresenceTTL is how long a presence announcement stays valid. Clients
+	// re-announce the task they have open to keep their entry alive.
+	PresenceTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		WriteWait:      10 * time.Second,
+		PongWait:       60 * time.Second,
+		PingPeriod:     54 * time.Second,
+		MaxMessageSize: 4096,
+		SendBuffer:     256,
+		PresenceTTL:    45 * time.Second,
+	}
+}
+
+// normalize fills zero values with defaults and keeps PingPeriod below PongWait.
+func (c Config) normalize() Config {
+	def := DefaultConfig()
+	if c.WriteWait <= 0 {
+		c.WriteWait = def.WriteWait
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = def.PongWait
+	}
+	if c.PingPeriod <= 0 || c.PingPeriod >= c.PongWait {
+		c.PingPeriod = c.PongWait * 9 / 10
+	}
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = def.MaxMessageSize
+	}
+	if c.SendBuffer <= 0 {
+		c.SendBuffer = def.SendBuffer
+	}
+	if c.PresenceTTL <= 0 {
+		c.PresenceTTL = def.PresenceTTL
+	}
+	return c
+}
@@ -1,16 +1,41 @@
 package realtime
 
 import (
+	"GoProjects/TaskTracker/internal/logger"
+	"GoProjects/TaskTracker/internal/metrics"
 	"context"
 	"encoding/json"
 	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"time"
 )
 
 type Hub struct {
+	cfg        Config
 	clients    map[*Client]bool
-	broadcast  chan []byte
+	broadcast  chan outbound
 	Register   chan *Client
 	unregister chan *Client
+	// presenceChanged receives tasks whose viewers changed outside Run.
+	presenceChanged chan []int
+
+	presence *presence
+	// presenceDirty holds tasks whose viewers changed inside Run and still
+	// have to be announced.
+	presenceDirty []int
+
+	// TaskOwner looks up the owner of the task, the only user who may
+	// announce presence on it and receive its presence_changed messages. It
+	// is called when a client opens a task, never from Run. When nil every
+	// authenticated user may. Anonymous connections never receive presence.
+	TaskOwner func(taskID int) (userID int, ok bool)
+}
+
+// outbound is a message for the clients of one user, or of all clients when
+// userID is 0.
+type outbound struct {
+	userID int
+	data   []byte
 }
 
 type Message struct {
@@ -18,51 +43,172 @@ type Message struct {
 	Data interface{} `json:"data"`
 }
 
-type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+// Delivery is a message for the clients of one user, as relayed from the
+// worker to the servers.
+type Delivery struct {
+	UserID  int     `json:"user_id"`
+	Message Message `json:"message"`
+}
+
+// PresenceChanged is the payload of presence_changed messages.
+type PresenceChanged struct {
+	TaskID  int      `json:"task_id"`
+	Viewers []Viewer `json:"viewers"`
 }
 
-func NewHub() *Hub {
+func NewHub(cfg Config) *Hub {
+	cfg = cfg.normalize()
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		Register:   make(chan *Client),
-		unregister: make(chan *Client),
+		cfg:             cfg,
+		clients:         make(map[*Client]bool),
+		broadcast:       make(chan outbound),
+		Register:        make(chan *Client),
+		unregister:      make(chan *Client),
+		presenceChanged: make(chan []int),
+		presence:        newPresence(cfg.PresenceTTL),
 	}
 }
 
 func (h *Hub) Run(ctx context.Context) {
+	sweep := time.NewTicker(h.cfg.PresenceTTL / 2)
+	defer sweep.Stop()
+
 	for {
 		select {
 		case client := <-h.Register:
 			h.clients[client] = true
+			metrics.WSConnectedClients.Inc()
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.remove(client, websocket.CloseNormalClosure, "")
+			} else {
+				// Already dropped, but it may have announced presence since.
+				h.presenceDirty = append(h.presenceDirty, h.presence.drop(client)...)
 			}
 
 		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
-			}
+			h.fanout(message)
+		case changed := <-h.presenceChanged:
+			h.presenceDirty = append(h.presenceDirty, changed...)
+		case now := <-sweep.C:
+			h.presenceDirty = append(h.presenceDirty, h.presence.sweep(now)...)
 		case <-ctx.Done():
 			for client := range h.clients {
-				close(client.send)
-				delete(h.clients, client)
+				h.remove(client, websocket.CloseGoingAway, "server shutting down")
 			}
 			return
 		}
+		h.flushPresence()
+	}
+}
+
+// fanout queues the message on the clients it is for. Must only be called from Run.
+func (h *Hub) fanout(message outbound) {
+	for client := range h.clients {
+		if message.userID != 0 && client.userID != message.userID {
+			continue
+		}
+		h.send(client, message.data)
+	}
+}
+
+// send queues the message on the client, dropping clients that fall behind.
+// Must only be called from Run.
+func (h *Hub) send(client *Client, message []byte) {
+	select {
+	case client.send <- message:
+		metrics.WSSendQueueDepth.Observe(float64(len(client.send)))
+	default:
+		logger.Log.Warn("ws slow consumer dropped",
+			zap.String("remote", client.conn.RemoteAddr().String()),
+			zap.Int("queued", len(client.send)),
+		)
+		metrics.WSSlowConsumersDropped.Inc()
+		h.remove(client, websocket.CloseTryAgainLater, "slow consumer")
 	}
 }
+
+// remove drops the client from the hub and tells its WritePump to send a close frame.
+func (h *Hub) remove(client *Client, code int, reason string) {
+	delete(h.clients, client)
+	client.disconnect(code, reason)
+	metrics.WSConnectedClients.Dec()
+	h.presenceDirty = append(h.presenceDirty, h.presence.drop(client)...)
+}
+
+func (h *Hub) flushPresence() {
+	for len(h.presenceDirty) > 0 {
+		taskID := h.presenceDirty[0]
+		h.presenceDirty = h.presenceDirty[1:]
+		h.fanoutPresence(taskID)
+	}
+}
+
+// fanoutPresence sends the viewers of the task to the clients of its owner,
+// as recorded when the task was opened. Must only be called from Run.
+func (h *Hub) fanoutPresence(taskID int) {
+	ownerID, ok := h.presence.owner(taskID)
+	if !ok {
+		return
+	}
+	message := h.presenceMessage(taskID)
+	for client := range h.clients {
+		if client.userID == 0 || (ownerID != 0 && client.userID != ownerID) {
+			continue
+		}
+		h.send(client, message)
+	}
+	h.presence.forget(taskID)
+}
+
+func (h *Hub) presenceMessage(taskID int) []byte {
+	data, _ := json.Marshal(Message{
+		Type: "presence_changed",
+		Data: PresenceChanged{TaskID: taskID, Viewers: h.Presence(taskID)},
+	})
+	return data
+}
+
+// Presence returns the users that currently have the task open.
+func (h *Hub) Presence(taskID int) []Viewer {
+	return h.presence.viewers(taskID)
+}
+
+// announce handles a presence message received from the client.
+func (h *Hub) announce(c *Client, taskID int, state PresenceState) {
+	var changed []int
+	switch {
+	case state == PresenceLeft || taskID == 0:
+		changed = h.presence.drop(c)
+	case state == PresenceViewing || state == PresenceEditing:
+		// The owner is looked up only when nobody has the task open yet.
+		ownerID, known := h.presence.owner(taskID)
+		if !known && h.TaskOwner != nil {
+			if ownerID, known = h.TaskOwner(taskID); !known {
+				return
+			}
+		}
+		if ownerID != 0 && ownerID != c.userID {
+			return
+		}
+		changed = h.presence.set(c, c.userID, ownerID, taskID, state, time.Now())
+	default:
+		return
+	}
+
+	if len(changed) > 0 {
+		h.presenceChanged <- changed
+	}
+}
+
 func (h *Hub) Broadcast(message Message) {
 	data, _ := json.Marshal(message)
-	h.broadcast <- data
+	h.broadcast <- outbound{data: data}
+}
+
+// BroadcastTo sends the message to the clients of the user only, e.g. the
+// owner of the task it is about.
+func (h *Hub) BroadcastTo(userID int, message Message) {
+	data, _ := json.Marshal(message)
+	h.broadcast <- outbound{userID: userID, data: data}
 }
@@ -0,0 +1,178 @@
+package realtime
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type PresenceState string
+
+const (
+	PresenceViewing PresenceState = "viewing"
+	PresenceEditing PresenceState = "editing"
+	PresenceLeft    PresenceState = "left"
+)
+
+// Viewer is a user that currently has a task open.
+type Viewer struct {
+	UserID int           `json:"user_id"`
+	State  PresenceState `json:"state"`
+	Since  time.Time     `json:"since"`
+}
+
+type presenceEntry struct {
+	taskID    int
+	userID    int
+	state     PresenceState
+	since     time.Time
+	expiresAt time.Time
+}
+
+// presence keeps per-task viewer sets. Every client has at most one task open,
+// and its entry expires unless the client re-announces it within ttl.
+type presence struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	byTask   map[int]map[*Client]*presenceEntry
+	byClient map[*Client]*presenceEntry
+	// owners holds the owner of every task that has viewers, or had them
+	// until its last presence_changed was sent. 0 means any user.
+	owners map[int]int
+}
+
+func newPresence(ttl time.Duration) *presence {
+	return &presence{
+		ttl:      ttl,
+		byTask:   make(map[int]map[*Client]*presenceEntry),
+		byClient: make(map[*Client]*presenceEntry),
+		owners:   make(map[int]int),
+	}
+}
+
+// set records that the client has taskID, owned by ownerID, open in the given
+// state and returns the tasks whose viewer list changed.
+func (p *presence) set(c *Client, userID, ownerID, taskID int, state PresenceState, now time.Time) []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.owners[taskID] = ownerID
+
+	prev, ok := p.byClient[c]
+	if ok && prev.taskID == taskID {
+		prev.expiresAt = now.Add(p.ttl)
+		if prev.state == state {
+			return nil
+		}
+		prev.state = state
+		return []int{taskID}
+	}
+
+	var changed []int
+	if ok {
+		p.deleteLocked(c, prev)
+		changed = append(changed, prev.taskID)
+	}
+
+	e := &presenceEntry{taskID: taskID, userID: userID, state: state, since: now, expiresAt: now.Add(p.ttl)}
+	viewers, ok := p.byTask[taskID]
+	if !ok {
+		viewers = make(map[*Client]*presenceEntry)
+		p.byTask[taskID] = viewers
+	}
+	viewers[c] = e
+	p.byClient[c] = e
+	return append(changed, taskID)
+}
+
+// drop removes whatever the client had open and returns the affected tasks.
+func (p *presence) drop(c *Client) []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.byClient[c]
+	if !ok {
+		return nil
+	}
+	p.deleteLocked(c, e)
+	return []int{e.taskID}
+}
+
+// owner returns the owner recorded for the task.
+func (p *presence) owner(taskID int) (int, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	ownerID, ok := p.owners[taskID]
+	return ownerID, ok
+}
+
+// forget drops the owner of the task once nobody has it open anymore.
+func (p *presence) forget(taskID int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.byTask[taskID]) == 0 {
+		delete(p.owners, taskID)
+	}
+}
+
+// sweep removes expired entries and returns the affected tasks.
+func (p *presence) sweep(now time.Time) []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen := make(map[int]bool)
+	var changed []int
+	for c, e := range p.byClient {
+		if now.Before(e.expiresAt) {
+			continue
+		}
+		p.deleteLocked(c, e)
+		if !seen[e.taskID] {
+			seen[e.taskID] = true
+			changed = append(changed, e.taskID)
+		}
+	}
+	return changed
+}
+
+func (p *presence) deleteLocked(c *Client, e *presenceEntry) {
+	delete(p.byClient, c)
+	viewers := p.byTask[e.taskID]
+	delete(viewers, c)
+	if len(viewers) == 0 {
+		delete(p.byTask, e.taskID)
+	}
+}
+
+// viewers returns one entry per user that has the task open. A user with several
+// connections is reported as editing if any of them is editing.
+func (p *presence) viewers(taskID int) []Viewer {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	byUser := make(map[int]*Viewer)
+	for _, e := range p.byTask[taskID] {
+		v, ok := byUser[e.userID]
+		if !ok {
+			byUser[e.userID] = &Viewer{UserID: e.userID, State: e.state, Since: e.since}
+			continue
+		}
+		if e.state == PresenceEditing {
+			v.State = PresenceEditing
+		}
+		if e.since.Before(v.Since) {
+			v.Since = e.since
+		}
+	}
+
+	result := make([]Viewer, 0, len(byUser))
+	for _, v := range byUser {
+		result = append(result, *v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Since.Before(result[j].Since)
+	})
+	return result
+}
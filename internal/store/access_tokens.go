@@ -0,0 +1,116 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// accessTokenTouchInterval limits how often the last use of a token is written.
+const accessTokenTouchInterval = time.Minute
+
+// AccessTokenStore keeps personal access tokens by their hash.
+type AccessTokenStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewAccessTokenStore(pool *pgxpool.Pool) *AccessTokenStore {
+	return &AccessTokenStore{Pool: pool}
+}
+
+const accessTokenColumns = `id, user_id, name, prefix, scopes, expires_at, created_at, last_used_at`
+
+func scanAccessToken(row pgx.Row) (*models.AccessToken, error) {
+	t := &models.AccessToken{}
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.CreatedAt, &t.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *AccessTokenStore) Create(ctx context.Context, t *models.AccessToken, tokenHash string) error {
+	query := `INSERT INTO access_tokens (user_id, name, prefix, token_hash, scopes, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING ` + accessTokenColumns
+	created, err := scanAccessToken(s.Pool.QueryRow(ctx, query, t.UserID, t.Name, t.Prefix, tokenHash, t.Scopes, t.ExpiresAt))
+	if err != nil {
+		return err
+	}
+	*t = *created
+	return nil
+}
+
+// List returns the user's tokens that weren't revoked, expired ones included,
+// newest first.
+func (s *AccessTokenStore) List(ctx context.Context, userID int) ([]*models.AccessToken, error) {
+	query := `SELECT ` + accessTokenColumns + ` FROM access_tokens
+			  WHERE user_id = $1 AND revoked_at IS NULL
+			  ORDER BY created_at DESC, id DESC`
+	rows, err := s.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*models.AccessToken{}
+	for rows.Next() {
+		t, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Authenticate returns the valid token with the given hash and records its use.
+// It returns pgx.ErrNoRows for unknown, revoked and expired tokens.
+func (s *AccessTokenStore) Authenticate(ctx context.Context, tokenHash string) (*models.AccessToken, error) {
+	query := `SELECT ` + accessTokenColumns + `,
+			  	(SELECT email_verified_at IS NULL FROM users WHERE users.id = access_tokens.user_id)
+			  FROM access_tokens
+			  WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())`
+	t := &models.AccessToken{}
+	err := s.Pool.QueryRow(ctx, query, tokenHash).Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes,
+		&t.ExpiresAt, &t.CreatedAt, &t.LastUsedAt, &t.EmailUnverified)
+	if err != nil {
+		return nil, err
+	}
+	if t.LastUsedAt == nil || time.Since(*t.LastUsedAt) > accessTokenTouchInterval {
+		if _, err := s.Pool.Exec(ctx, `UPDATE access_tokens SET last_used_at = now() WHERE id = $1`, t.ID); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Revoke revokes the user's token. It returns pgx.ErrNoRows if there is no such
+// token or it's already revoked.
+func (s *AccessTokenStore) Revoke(ctx context.Context, userID, id int) error {
+	tag, err := s.Pool.Exec(ctx, `UPDATE access_tokens SET revoked_at = now()
+		WHERE user_id = $1 AND id = $2 AND revoked_at IS NULL`, userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeAll revokes every token of the user and returns how many there were.
+func (s *AccessTokenStore) RevokeAll(ctx context.Context, userID int) (int64, error) {
+	return revokeAccessTokens(ctx, s.Pool, userID)
+}
+
+func revokeAccessTokens(ctx context.Context, db dbtx, userID int) (int64, error) {
+	tag, err := db.Exec(ctx, `UPDATE access_tokens SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AttachmentStore keeps attachment metadata. The content lives in a blob.BlobStore
+// under StorageKey.
+type AttachmentStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewAttachmentStore(pool *pgxpool.Pool) *AttachmentStore {
+	return &AttachmentStore{Pool: pool}
+}
+
+const attachmentColumns = `id, task_id, user_id, filename, content_type, size, sha256, storage_key, created_at`
+
+func scanAttachment(row pgx.Row) (*models.Attachment, error) {
+	a := &models.Attachment{}
+	err := row.Scan(&a.ID, &a.TaskID, &a.UserID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.StorageKey, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *AttachmentStore) Create(ctx context.Context, a *models.Attachment) error {
+	query := `INSERT INTO task_attachments (task_id, user_id, filename, content_type, size, sha256, storage_key)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  RETURNING id, created_at`
+	return s.Pool.QueryRow(ctx, query, a.TaskID, a.UserID, a.Filename, a.ContentType, a.Size, a.SHA256, a.StorageKey).
+		Scan(&a.ID, &a.CreatedAt)
+}
+
+// Get returns the attachment only if it belongs to the given task.
+func (s *AttachmentStore) Get(ctx context.Context, taskID, id int) (*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM task_attachments WHERE id = $1 AND task_id = $2`
+	return scanAttachment(s.Pool.QueryRow(ctx, query, id, taskID))
+}
+
+func (s *AttachmentStore) List(ctx context.Context, taskID int) ([]*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM task_attachments WHERE task_id = $1 ORDER BY id`
+	return s.collect(ctx, query, taskID)
+}
+
+// Delete removes the attachment and queues its file in blob_deletions, in one
+// transaction. The caller deletes the file and then calls BlobDeleted; files
+// it couldn't delete are retried by the worker.
+func (s *AttachmentStore) Delete(ctx context.Context, id int) error {
+	return pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		var key string
+		err := tx.QueryRow(ctx, `DELETE FROM task_attachments WHERE id = $1 RETURNING storage_key`, id).Scan(&key)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO blob_deletions (storage_key) VALUES ($1) ON CONFLICT DO NOTHING`, key)
+		return err
+	})
+}
+
+// OrphanedBlobs returns up to limit storage keys of files whose attachments
+// were deleted or purged, oldest first.
+func (s *AttachmentStore) OrphanedBlobs(ctx context.Context, limit int) ([]string, error) {
+	rows, err := s.Pool.Query(ctx, `SELECT storage_key FROM blob_deletions ORDER BY created_at LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// BlobDeleted forgets the orphaned file once it was deleted.
+func (s *AttachmentStore) BlobDeleted(ctx context.Context, key string) error {
+	_, err := s.Pool.Exec(ctx, `DELETE FROM blob_deletions WHERE storage_key = $1`, key)
+	return err
+}
+
+func (s *AttachmentStore) collect(ctx context.Context, query string, args ...interface{}) ([]*models.Attachment, error) {
+	rows, err := s.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*models.Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
+	"time"
+)
+
+// auditLockID serializes appends, so that every entry chains to the last one.
+const auditLockID = 7_050_001
+
+// auditVerifyBatch is how many entries Verify reads at a time.
+const auditVerifyBatch = 1000
+
+// AuditStore keeps the append-only audit log.
+type AuditStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewAuditStore(pool *pgxpool.Pool) *AuditStore {
+	return &AuditStore{Pool: pool}
+}
+
+const auditColumns = `id, occurred_at, action, actor_id, ip, request_id, target_type, target_id, diff, prev_hash, hash`
+
+func scanAuditEntry(row pgx.Row) (*models.AuditEntry, error) {
+	e := &models.AuditEntry{}
+	err := row.Scan(&e.ID, &e.OccurredAt, &e.Action, &e.ActorID, &e.IP, &e.RequestID, &e.TargetType, &e.TargetID,
+		&e.Diff, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// auditHash returns the hash of the entry, which covers the hash of the one before.
+func auditHash(e *models.AuditEntry) string {
+	fields, _ := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		e.Action,
+		e.ActorID,
+		e.IP,
+		e.RequestID,
+		e.TargetType,
+		e.TargetID,
+		e.Diff,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// Append chains the entry to the last one and stores it.
+func (s *AuditStore) Append(ctx context.Context, e *models.AuditEntry) error {
+	// The database keeps microseconds; the hash must cover what's stored.
+	e.OccurredAt = e.OccurredAt.UTC().Truncate(time.Microsecond)
+	if len(e.Diff) == 0 {
+		e.Diff = json.RawMessage(`{}`)
+	}
+
+	return pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, auditLockID); err != nil {
+			return err
+		}
+		err := tx.QueryRow(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&e.PrevHash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			e.PrevHash = ""
+		} else if err != nil {
+			return err
+		}
+		e.Hash = auditHash(e)
+
+		query := `INSERT INTO audit_log (occurred_at, action, actor_id, ip, request_id, target_type, target_id, diff, prev_hash, hash)
+				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				  RETURNING id`
+		return tx.QueryRow(ctx, query, e.OccurredAt, e.Action, e.ActorID, e.IP, e.RequestID, e.TargetType, e.TargetID,
+			string(e.Diff), e.PrevHash, e.Hash).Scan(&e.ID)
+	})
+}
+
+type AuditFilter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	// BeforeID continues a listing below the last entry seen.
+	BeforeID int64
+	Limit    int
+}
+
+func (f AuditFilter) where() (string, []interface{}) {
+	conds := []string{"true"}
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorID != 0 {
+		add("actor_id = $%d", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if !f.Since.IsZero() {
+		add("occurred_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("occurred_at < $%d", f.Until)
+	}
+	if f.BeforeID > 0 {
+		add("id < $%d", f.BeforeID)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// List returns the matching entries, newest first.
+func (s *AuditStore) List(ctx context.Context, f AuditFilter) ([]*models.AuditEntry, error) {
+	where, args := f.where()
+	args = append(args, f.Limit)
+	query := fmt.Sprintf(`SELECT %s FROM audit_log WHERE %s ORDER BY id DESC LIMIT $%d`, auditColumns, where, len(args))
+	rows, err := s.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Verify walks the whole log and checks that every entry links to the one
+// before and still has the hash it was stored with.
+func (s *AuditStore) Verify(ctx context.Context) (*models.AuditVerification, error) {
+	result := &models.AuditVerification{Valid: true}
+	prev := ""
+	var lastID int64
+	for {
+		rows, err := s.Pool.Query(ctx, `SELECT `+auditColumns+` FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2`,
+			lastID, auditVerifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.AuditEntry, error) {
+			return scanAuditEntry(row)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			if e.PrevHash != prev || auditHash(e) != e.Hash {
+				result.Valid = false
+				result.BrokenAt = &e.ID
+				return result, nil
+			}
+			prev = e.Hash
+			lastID = e.ID
+			result.Checked++
+		}
+		if len(entries) < auditVerifyBatch {
+			return result, nil
+		}
+	}
+}
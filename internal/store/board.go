@@ -0,0 +1,245 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"GoProjects/TaskTracker/internal/rank"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrWIPLimit is returned when a task would enter a board column that already
+// holds as many tasks as its WIP limit allows.
+var ErrWIPLimit = errors.New("WIP limit reached")
+
+// ErrInvalidNeighbor is returned by Move when before_id or after_id doesn't name
+// another task in the target column, or when they are in the wrong order.
+var ErrInvalidNeighbor = errors.New("neighbors must be other tasks of the target column, before_id above after_id")
+
+// BoardStore keeps the per-user settings of the board columns.
+type BoardStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewBoardStore(pool *pgxpool.Pool) *BoardStore {
+	return &BoardStore{Pool: pool}
+}
+
+// WIPLimits returns the WIP limits of the user's columns by status. Columns
+// without a limit are missing from the map.
+func (s *BoardStore) WIPLimits(ctx context.Context, userID int) (map[string]int, error) {
+	rows, err := s.Pool.Query(ctx, `SELECT status, wip_limit FROM board_columns WHERE user_id = $1 AND wip_limit IS NOT NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var limit int
+		if err := rows.Scan(&status, &limit); err != nil {
+			return nil, err
+		}
+		limits[status] = limit
+	}
+	return limits, rows.Err()
+}
+
+// SetWIPLimit sets the WIP limit of the user's column. A nil limit removes it.
+func (s *BoardStore) SetWIPLimit(ctx context.Context, userID int, status string, limit *int) error {
+	query := `INSERT INTO board_columns (user_id, status, wip_limit) VALUES ($1, $2, $3)
+			  ON CONFLICT (user_id, status) DO UPDATE SET wip_limit = EXCLUDED.wip_limit`
+	_, err := s.Pool.Exec(ctx, query, userID, status, limit)
+	return err
+}
+
+// checkWIP returns ErrWIPLimit if another task can't enter the user's column.
+// It locks the column settings, so concurrent moves into a limited column are
+// checked one after another. The task being moved is not counted.
+func checkWIP(ctx context.Context, db dbtx, userID int, status string, taskID int) error {
+	var limit *int
+	err := db.QueryRow(ctx, `SELECT wip_limit FROM board_columns WHERE user_id = $1 AND status = $2 FOR UPDATE`, userID, status).Scan(&limit)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && limit == nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var count int
+	query := `SELECT count(*) FROM tasks WHERE user_id = $1 AND status = $2 AND deleted_at IS NULL AND id <> $3`
+	if err := db.QueryRow(ctx, query, userID, status, taskID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= *limit {
+		return fmt.Errorf("%w: column %s allows %d tasks", ErrWIPLimit, status, *limit)
+	}
+	return nil
+}
+
+// appendRank returns a rank that puts a task at the bottom of the user's column.
+func appendRank(ctx context.Context, db dbtx, userID int, status string) (string, error) {
+	var last string
+	query := `SELECT rank FROM tasks WHERE user_id = $1 AND status = $2 AND deleted_at IS NULL
+			  ORDER BY rank DESC, id DESC LIMIT 1`
+	err := db.QueryRow(ctx, query, userID, status).Scan(&last)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+	return rank.Between(last, "")
+}
+
+// Board returns the user's tasks ordered by their rank within each status.
+func (s *TaskStore) Board(ctx context.Context, userID int) ([]*models.Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE user_id = $1 AND deleted_at IS NULL ORDER BY rank, id`
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*models.Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// Move puts the task into the status column between the tasks beforeID (above
+// it) and afterID (below it). With only one neighbor the task goes right next
+// to it, with none to the bottom of the column. Only the moved task's row is
+// rewritten. Its version is bumped like on any other change, but a move within
+// the column changes no field and records no revision.
+func (s *TaskStore) Move(ctx context.Context, actorID, id int, status string, beforeID, afterID *int, expectedVersion int) (*models.Task, error) {
+	var moved *models.Task
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := scanTask(tx.QueryRow(ctx, `SELECT `+taskColumns+` FROM tasks WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id))
+		if err != nil {
+			return err
+		}
+		if expectedVersion > 0 && current.Version != expectedVersion {
+			return ErrVersionConflict
+		}
+		if status != current.Status {
+			if err := checkWIP(ctx, tx, current.UserID, status, id); err != nil {
+				return err
+			}
+		}
+
+		newRank, err := rankBetween(ctx, tx, current, status, beforeID, afterID)
+		if errors.Is(err, rank.ErrInvalidRange) {
+			// Equal neighbor ranks leave no room: respace the column and retry once.
+			if err := rebalance(ctx, tx, current.UserID, status, id); err != nil {
+				return err
+			}
+			newRank, err = rankBetween(ctx, tx, current, status, beforeID, afterID)
+		}
+		if errors.Is(err, rank.ErrInvalidRange) {
+			return ErrInvalidNeighbor
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE tasks SET status = $1, rank = $2, version = version + 1, updated_at = now()
+				  WHERE id = $3 RETURNING ` + taskColumns
+		moved, err = scanTask(tx.QueryRow(ctx, query, status, newRank, id))
+		if err != nil {
+			return err
+		}
+		changes := diffTask(snapshotOf(current), snapshotOf(moved))
+		if len(changes) == 0 {
+			return nil
+		}
+		return insertRevision(ctx, tx, moved, actorID, changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// rankBetween finds the ranks around the target position of t and returns a rank between them.
+func rankBetween(ctx context.Context, tx pgx.Tx, t *models.Task, status string, beforeID, afterID *int) (string, error) {
+	neighbor := func(nid int) (string, error) {
+		var r string
+		query := `SELECT rank FROM tasks WHERE id = $1 AND user_id = $2 AND status = $3 AND deleted_at IS NULL AND id <> $4`
+		err := tx.QueryRow(ctx, query, nid, t.UserID, status, t.ID).Scan(&r)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidNeighbor
+		}
+		return r, err
+	}
+	adjacent := func(query string, args ...interface{}) (string, error) {
+		var r string
+		err := tx.QueryRow(ctx, query, args...).Scan(&r)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return r, err
+	}
+	const column = `user_id = $1 AND status = $2 AND deleted_at IS NULL AND id <> $3`
+
+	var lo, hi string
+	var err error
+	switch {
+	case beforeID != nil && afterID != nil:
+		if *beforeID == *afterID {
+			return "", ErrInvalidNeighbor
+		}
+		if lo, err = neighbor(*beforeID); err != nil {
+			return "", err
+		}
+		if hi, err = neighbor(*afterID); err != nil {
+			return "", err
+		}
+		if lo > hi {
+			return "", ErrInvalidNeighbor
+		}
+	case beforeID != nil:
+		if lo, err = neighbor(*beforeID); err != nil {
+			return "", err
+		}
+		hi, err = adjacent(`SELECT rank FROM tasks WHERE `+column+` AND (rank, id) > ($4, $5) ORDER BY rank, id LIMIT 1`,
+			t.UserID, status, t.ID, lo, *beforeID)
+	case afterID != nil:
+		if hi, err = neighbor(*afterID); err != nil {
+			return "", err
+		}
+		lo, err = adjacent(`SELECT rank FROM tasks WHERE `+column+` AND (rank, id) < ($4, $5) ORDER BY rank DESC, id DESC LIMIT 1`,
+			t.UserID, status, t.ID, hi, *afterID)
+	default:
+		lo, err = adjacent(`SELECT rank FROM tasks WHERE `+column+` ORDER BY rank DESC, id DESC LIMIT 1`,
+			t.UserID, status, t.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return rank.Between(lo, hi)
+}
+
+// rebalance rewrites the ranks of the user's column evenly, keeping their order.
+func rebalance(ctx context.Context, tx pgx.Tx, userID int, status string, excludeID int) error {
+	rows, err := tx.Query(ctx, `SELECT id FROM tasks WHERE user_id = $1 AND status = $2 AND deleted_at IS NULL AND id <> $3
+		ORDER BY rank, id`, userID, status, excludeID)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	for i, id := range ids {
+		batch.Queue(`UPDATE tasks SET rank = $1 WHERE id = $2`, rank.Nth(i), id)
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
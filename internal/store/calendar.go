@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CalendarStore keeps the secret tokens of the users' calendar feeds.
+// Only a hash of each token is stored.
+type CalendarStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewCalendarStore(pool *pgxpool.Pool) *CalendarStore {
+	return &CalendarStore{Pool: pool}
+}
+
+// SetToken replaces the user's feed token, invalidating the previous one.
+func (s *CalendarStore) SetToken(ctx context.Context, userID int, tokenHash string) error {
+	query := `INSERT INTO calendar_feeds (user_id, token_hash) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = now()`
+	_, err := s.Pool.Exec(ctx, query, userID, tokenHash)
+	return err
+}
+
+// DeleteToken disables the user's feed.
+func (s *CalendarStore) DeleteToken(ctx context.Context, userID int) error {
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM calendar_feeds WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// UserByToken returns the owner of the feed with the given token hash.
+func (s *CalendarStore) UserByToken(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := s.Pool.QueryRow(ctx, `SELECT user_id FROM calendar_feeds WHERE token_hash = $1`, tokenHash).Scan(&userID)
+	return userID, err
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrChecklistFull is returned when a task already has models.MaxChecklistItems items.
+var ErrChecklistFull = errors.New("checklist is full")
+
+// ErrChecklistOrder is returned by Reorder when the ids are not exactly the task's items.
+var ErrChecklistOrder = errors.New("ids must list every checklist item exactly once")
+
+// ChecklistStore keeps the ordered checklist items of tasks. Positions are kept
+// dense, from 0 to the number of items minus one. Every change locks the task row,
+// so concurrent changes to the same checklist are applied one after another.
+type ChecklistStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewChecklistStore(pool *pgxpool.Pool) *ChecklistStore {
+	return &ChecklistStore{Pool: pool}
+}
+
+const checklistColumns = `id, task_id, text, checked, position, created_at, updated_at`
+
+func scanChecklistItem(row pgx.Row) (*models.ChecklistItem, error) {
+	i := &models.ChecklistItem{}
+	err := row.Scan(&i.ID, &i.TaskID, &i.Text, &i.Checked, &i.Position, &i.CreatedAt, &i.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func lockTask(ctx context.Context, tx pgx.Tx, taskID int) error {
+	var id int
+	return tx.QueryRow(ctx, `SELECT id FROM tasks WHERE id = $1 FOR UPDATE`, taskID).Scan(&id)
+}
+
+func (s *ChecklistStore) List(ctx context.Context, taskID int) ([]*models.ChecklistItem, error) {
+	return listChecklist(ctx, s.Pool, taskID)
+}
+
+func listChecklist(ctx context.Context, db dbtx, taskID int) ([]*models.ChecklistItem, error) {
+	rows, err := db.Query(ctx, `SELECT `+checklistColumns+` FROM checklist_items WHERE task_id = $1 ORDER BY position`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*models.ChecklistItem{}
+	for rows.Next() {
+		i, err := scanChecklistItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+// Progress counts the checked and total items of the task's checklist.
+func (s *ChecklistStore) Progress(ctx context.Context, taskID int) (models.ChecklistProgress, error) {
+	var p models.ChecklistProgress
+	err := s.Pool.QueryRow(ctx, `SELECT count(*) FILTER (WHERE checked), count(*) FROM checklist_items WHERE task_id = $1`, taskID).
+		Scan(&p.Done, &p.Total)
+	return p, err
+}
+
+// Add inserts the item at position, shifting the items after it, or appends it
+// when position is nil or past the end.
+func (s *ChecklistStore) Add(ctx context.Context, taskID int, text string, position *int) (*models.ChecklistItem, error) {
+	var item *models.ChecklistItem
+	err := pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		if err := lockTask(ctx, tx, taskID); err != nil {
+			return err
+		}
+		var count int
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM checklist_items WHERE task_id = $1`, taskID).Scan(&count); err != nil {
+			return err
+		}
+		if count >= models.MaxChecklistItems {
+			return ErrChecklistFull
+		}
+
+		pos := count
+		if position != nil && *position < count {
+			pos = *position
+			_, err := tx.Exec(ctx, `UPDATE checklist_items SET position = position + 1 WHERE task_id = $1 AND position >= $2`, taskID, pos)
+			if err != nil {
+				return err
+			}
+		}
+
+		query := `INSERT INTO checklist_items (task_id, text, position) VALUES ($1, $2, $3) RETURNING ` + checklistColumns
+		var err error
+		item, err = scanChecklistItem(tx.QueryRow(ctx, query, taskID, text, pos))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Update changes the text and checked state of the task's item and moves it to
+// req.Position when set.
+func (s *ChecklistStore) Update(ctx context.Context, taskID, id int, req models.ChecklistItemRequest) (*models.ChecklistItem, error) {
+	var item *models.ChecklistItem
+	err := pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		if err := lockTask(ctx, tx, taskID); err != nil {
+			return err
+		}
+		current, err := scanChecklistItem(tx.QueryRow(ctx,
+			`SELECT `+checklistColumns+` FROM checklist_items WHERE id = $1 AND task_id = $2`, id, taskID))
+		if err != nil {
+			return err
+		}
+
+		pos := current.Position
+		if req.Position != nil && *req.Position != current.Position {
+			var count int
+			if err := tx.QueryRow(ctx, `SELECT count(*) FROM checklist_items WHERE task_id = $1`, taskID).Scan(&count); err != nil {
+				return err
+			}
+			pos = min(*req.Position, count-1)
+			// Close the gap at the old position, then open one at the new position.
+			_, err := tx.Exec(ctx, `UPDATE checklist_items
+				SET position = position + CASE WHEN position > $2 AND position <= $3 THEN -1
+				                               WHEN position < $2 AND position >= $3 THEN 1
+				                               ELSE 0 END
+				WHERE task_id = $1 AND id <> $4`, taskID, current.Position, pos, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		text, checked := current.Text, current.Checked
+		if req.Text != nil {
+			text = *req.Text
+		}
+		if req.Checked != nil {
+			checked = *req.Checked
+		}
+		query := `UPDATE checklist_items SET text = $1, checked = $2, position = $3, updated_at = now()
+				  WHERE id = $4 RETURNING ` + checklistColumns
+		item, err = scanChecklistItem(tx.QueryRow(ctx, query, text, checked, pos, id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Reorder sets the order of all the task's items at once.
+func (s *ChecklistStore) Reorder(ctx context.Context, taskID int, ids []int) ([]*models.ChecklistItem, error) {
+	var items []*models.ChecklistItem
+	err := pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		if err := lockTask(ctx, tx, taskID); err != nil {
+			return err
+		}
+		current, err := listChecklist(ctx, tx, taskID)
+		if err != nil {
+			return err
+		}
+		if len(ids) != len(current) {
+			return ErrChecklistOrder
+		}
+		known := make(map[int]bool, len(current))
+		for _, i := range current {
+			known[i.ID] = true
+		}
+		for _, id := range ids {
+			if !known[id] {
+				return ErrChecklistOrder
+			}
+			delete(known, id)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE checklist_items c SET position = o.position - 1, updated_at = now()
+			FROM unnest($2::int[]) WITH ORDINALITY AS o(id, position)
+			WHERE c.task_id = $1 AND c.id = o.id AND c.position <> o.position - 1`, taskID, ids)
+		if err != nil {
+			return err
+		}
+		items, err = listChecklist(ctx, tx, taskID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Delete removes the task's item and closes the gap it leaves.
+func (s *ChecklistStore) Delete(ctx context.Context, taskID, id int) error {
+	return pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		if err := lockTask(ctx, tx, taskID); err != nil {
+			return err
+		}
+		var pos int
+		err := tx.QueryRow(ctx, `DELETE FROM checklist_items WHERE id = $1 AND task_id = $2 RETURNING position`, id, taskID).Scan(&pos)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE checklist_items SET position = position - 1 WHERE task_id = $1 AND position > $2`, taskID, pos)
+		return err
+	})
+}
@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"os"
 )
@@ -20,3 +22,12 @@ func NewDB() (*DB, error) {
 
 	return &DB{Pool: pool}, nil
 }
+
+// dbtx is implemented by both *pgxpool.Pool and pgx.Tx, so stores can run their
+// queries inside a caller's transaction. Begin on a pgx.Tx opens a savepoint.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
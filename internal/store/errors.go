@@ -0,0 +1,6 @@
+package store
+
+import "errors"
+
+// ErrVersionConflict is returned when a row was modified after the version the caller expected.
+var ErrVersionConflict = errors.New("version conflict")
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IdentityStore links accounts at external identity providers to users.
+type IdentityStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewIdentityStore(pool *pgxpool.Pool) *IdentityStore {
+	return &IdentityStore{Pool: pool}
+}
+
+// Resolve returns the user signing in as subject at issuer. An unknown identity
+// is linked to the user with the same email, ignoring case, or to a new user
+// without a password. The email must have been verified by the provider. The
+// second result tells which of models.IdentityKnown, IdentityLinked and
+// IdentityProvisioned happened. The last holds the sessions revoked when an
+// unverified account was taken over; their access tokens still need denying.
+func (s *IdentityStore) Resolve(ctx context.Context, issuer, subject, email string) (*models.User, string, []*models.Session, error) {
+	var user *models.User
+	var revoked []*models.Session
+	outcome := models.IdentityKnown
+	err := pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		userQuery := `SELECT ` + userColumns + ` FROM users`
+		scan := func(row pgx.Row) error {
+			u, err := scanUser(row)
+			user = u
+			return err
+		}
+
+		err := scan(tx.QueryRow(ctx, userQuery+`
+			WHERE id = (SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2)`, issuer, subject))
+		if err == nil {
+			_, err = tx.Exec(ctx, `UPDATE user_identities SET email = $3, last_login_at = now()
+				WHERE issuer = $1 AND subject = $2`, issuer, subject, email)
+			return err
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		outcome = models.IdentityLinked
+		err = scan(tx.QueryRow(ctx, userQuery+` WHERE lower(email) = lower($1) ORDER BY id LIMIT 1`, email))
+		if errors.Is(err, pgx.ErrNoRows) {
+			outcome = models.IdentityProvisioned
+			// A concurrent sign-in may create the user first; then it's linked instead.
+			err = scan(tx.QueryRow(ctx, `INSERT INTO users (email, password) VALUES ($1, '')
+				ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+				RETURNING `+userColumns, email))
+		}
+		if err != nil {
+			return err
+		}
+		// The provider vouches for the address. Whoever registered an unverified
+		// account with it may not own it, so everything they could sign in with
+		// goes: the password, sessions, access tokens and 2FA.
+		if user.EmailVerifiedAt == nil {
+			if err := scan(tx.QueryRow(ctx, `UPDATE users SET email_verified_at = now(), password = '' WHERE id = $1
+				RETURNING `+userColumns, user.ID)); err != nil {
+				return err
+			}
+			if revoked, err = revokeSessions(ctx, tx, `user_id = $1`, user.ID); err != nil {
+				return err
+			}
+			if _, err := revokeAccessTokens(ctx, tx, user.ID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, user.ID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, user.ID); err != nil {
+				return err
+			}
+		}
+
+		// The other sign-in may also have linked the identity already.
+		query := `INSERT INTO user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, $4)
+				  ON CONFLICT (issuer, subject) DO UPDATE SET email = EXCLUDED.email, last_login_at = now()
+				  RETURNING user_id`
+		var linkedID int
+		if err := tx.QueryRow(ctx, query, user.ID, issuer, subject, email).Scan(&linkedID); err != nil {
+			return err
+		}
+		if linkedID != user.ID {
+			return scan(tx.QueryRow(ctx, userQuery+` WHERE id = $1`, linkedID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return user, outcome, revoked, nil
+}
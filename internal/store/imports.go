@@ -0,0 +1,115 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type ImportStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewImportStore(pool *pgxpool.Pool) *ImportStore {
+	return &ImportStore{Pool: pool}
+}
+
+const importColumns = `id, user_id, format, filename, mapping, status, total_rows, processed_rows,
+	created_rows, failed_rows, errors, error, created_at, started_at, finished_at`
+
+func scanImport(row pgx.Row) (*models.Import, error) {
+	i := &models.Import{}
+	err := row.Scan(&i.ID, &i.UserID, &i.Format, &i.Filename, &i.Mapping, &i.Status, &i.TotalRows, &i.ProcessedRows,
+		&i.CreatedRows, &i.FailedRows, &i.Errors, &i.Error, &i.CreatedAt, &i.StartedAt, &i.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Create stores a pending import together with the uploaded file.
+func (s *ImportStore) Create(ctx context.Context, i *models.Import, payload []byte) error {
+	if i.Mapping == nil {
+		i.Mapping = map[string]string{}
+	}
+	query := `INSERT INTO imports (user_id, format, filename, mapping, payload)
+			  VALUES ($1, $2, $3, $4, $5)
+			  RETURNING ` + importColumns
+	created, err := scanImport(s.Pool.QueryRow(ctx, query, i.UserID, i.Format, i.Filename, i.Mapping, payload))
+	if err != nil {
+		return err
+	}
+	*i = *created
+	return nil
+}
+
+// Get by id
+func (s *ImportStore) Get(ctx context.Context, id int) (*models.Import, error) {
+	query := `SELECT ` + importColumns + ` FROM imports WHERE id = $1`
+	return scanImport(s.Pool.QueryRow(ctx, query, id))
+}
+
+// Claim marks a pending import as running and returns it with its file. An
+// import that was started before staleAfter and is still running is presumed
+// to be abandoned by a worker that died, and is claimed again; it keeps its
+// counters, so the new run can resume after the rows processed so far.
+// It returns pgx.ErrNoRows when the import doesn't exist or was already claimed.
+func (s *ImportStore) Claim(ctx context.Context, id int, staleAfter time.Duration) (*models.Import, []byte, error) {
+	query := `UPDATE imports SET status = $2, started_at = now()
+			  WHERE id = $1 AND (status = $3 OR (status = $2 AND started_at < now() - $4::interval))
+			  RETURNING payload`
+	var payload []byte
+	err := s.Pool.QueryRow(ctx, query, id, models.ImportRunning, models.ImportPending, staleAfter).Scan(&payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	i, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return i, payload, nil
+}
+
+// Stale returns the imports that were started before staleAfter and are still
+// running.
+func (s *ImportStore) Stale(ctx context.Context, staleAfter time.Duration) ([]int, error) {
+	rows, err := s.Pool.Query(ctx, `SELECT id FROM imports WHERE status = $1 AND started_at < now() - $2::interval`,
+		models.ImportRunning, staleAfter)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// SaveImportProgress saves the counters of a running import, in the
+// transaction of the store when it runs in InTx, so that they always match
+// the tasks created. It returns pgx.ErrNoRows when the import was claimed
+// again meanwhile.
+func (s *TaskStore) SaveImportProgress(ctx context.Context, i *models.Import) error {
+	query := `UPDATE imports
+			  SET total_rows = $2, processed_rows = $3, created_rows = $4, failed_rows = $5, errors = $6
+			  WHERE id = $1 AND started_at = $7`
+	tag, err := s.db.Exec(ctx, query, i.ID, i.TotalRows, i.ProcessedRows, i.CreatedRows, i.FailedRows, i.Errors,
+		i.StartedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Finish saves the final state of the import and drops the uploaded file,
+// unless the import was claimed again meanwhile.
+func (s *ImportStore) Finish(ctx context.Context, i *models.Import) error {
+	query := `UPDATE imports
+			  SET status = $2, total_rows = $3, processed_rows = $4, created_rows = $5, failed_rows = $6,
+			      errors = $7, error = $8, payload = NULL, finished_at = now()
+			  WHERE id = $1 AND started_at = $9`
+	_, err := s.Pool.Exec(ctx, query, i.ID, i.Status, i.TotalRows, i.ProcessedRows, i.CreatedRows, i.FailedRows, i.Errors, i.Error,
+		i.StartedAt)
+	return err
+}
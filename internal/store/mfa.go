@@ -0,0 +1,106 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrMFAEnabled is returned when enrolling a user whose 2FA is already on.
+var ErrMFAEnabled = errors.New("two-factor authentication is already enabled")
+
+type MFAStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewMFAStore(pool *pgxpool.Pool) *MFAStore {
+	return &MFAStore{Pool: pool}
+}
+
+// Get returns the enrollment of the user or pgx.ErrNoRows.
+func (s *MFAStore) Get(ctx context.Context, userID int) (*models.MFA, error) {
+	m := &models.MFA{}
+	query := `SELECT user_id, secret, enabled_at, last_counter, created_at FROM user_mfa WHERE user_id = $1`
+	err := s.Pool.QueryRow(ctx, query, userID).Scan(&m.UserID, &m.Secret, &m.EnabledAt, &m.LastCounter, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Begin stores a new secret for the user, replacing an unfinished enrollment.
+func (s *MFAStore) Begin(ctx context.Context, userID int, secret string) error {
+	query := `INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_counter = 0, created_at = now()
+			  WHERE user_mfa.enabled_at IS NULL`
+	tag, err := s.Pool.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAEnabled
+	}
+	return nil
+}
+
+// Enable turns on 2FA after the first code of the given time step was checked
+// and replaces the recovery codes.
+func (s *MFAStore) Enable(ctx context.Context, userID int, counter int64, recoveryHashes []string) error {
+	return pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE user_mfa SET enabled_at = now(), last_counter = $2
+			WHERE user_id = $1 AND enabled_at IS NULL`, userID, counter)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrMFAEnabled
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])`,
+			userID, recoveryHashes)
+		return err
+	})
+}
+
+// UseCounter records a code of the given time step as used. It reports false
+// if a code of this or a later step was accepted before, i.e. on replay.
+func (s *MFAStore) UseCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+	tag, err := s.Pool.Exec(ctx, `UPDATE user_mfa SET last_counter = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_counter < $2`, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode spends the recovery code and reports whether it was valid.
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	tag, err := s.Pool.Exec(ctx, `UPDATE mfa_recovery_codes SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RecoveryCodesLeft counts the unused recovery codes of the user.
+func (s *MFAStore) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := s.Pool.QueryRow(ctx, `SELECT count(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+// Disable removes the enrollment and the recovery codes of the user.
+func (s *MFAStore) Disable(ctx context.Context, userID int) error {
+	return pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+		return err
+	})
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+var (
+	// ErrRefreshTokenReused is returned by Rotate for a token that was already
+	// exchanged. Either the client or an attacker holds a copy of it, so the
+	// whole family should be revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrRefreshTokenInvalid is returned by Rotate for revoked and expired tokens.
+	ErrRefreshTokenInvalid = errors.New("refresh token invalid")
+)
+
+// RefreshTokenStore keeps refresh tokens by their hash.
+type RefreshTokenStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewRefreshTokenStore(pool *pgxpool.Pool) *RefreshTokenStore {
+	return &RefreshTokenStore{Pool: pool}
+}
+
+const refreshTokenColumns = `id, user_id, family_id, access_jti, access_expires_at, created_at, expires_at, used_at, revoked_at`
+
+func scanRefreshToken(row pgx.Row) (*models.RefreshToken, error) {
+	t := &models.RefreshToken{}
+	err := row.Scan(&t.ID, &t.UserID, &t.FamilyID, &t.AccessJTI, &t.AccessExpiresAt, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, t *models.RefreshToken, tokenHash string) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_jti, access_expires_at, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, created_at`
+	return s.Pool.QueryRow(ctx, query, t.UserID, t.FamilyID, tokenHash, t.AccessJTI, t.AccessExpiresAt, t.ExpiresAt).
+		Scan(&t.ID, &t.CreatedAt)
+}
+
+// Get returns the token with the given hash whatever its state.
+func (s *RefreshTokenStore) Get(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `SELECT ` + refreshTokenColumns + ` FROM refresh_tokens WHERE token_hash = $1`
+	return scanRefreshToken(s.Pool.QueryRow(ctx, query, tokenHash))
+}
+
+// Rotate marks the token as used and returns it, so it can be exchanged exactly
+// once even under concurrent requests. For a token that was already used it
+// returns the token together with ErrRefreshTokenReused.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `UPDATE refresh_tokens SET used_at = now()
+			  WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+			  RETURNING ` + refreshTokenColumns
+	t, err := scanRefreshToken(s.Pool.QueryRow(ctx, query, tokenHash))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return t, err
+	}
+
+	t, err = s.Get(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if t.UsedAt != nil && t.RevokedAt == nil {
+		return t, ErrRefreshTokenReused
+	}
+	return nil, ErrRefreshTokenInvalid
+}
+
+// DeleteExpired removes tokens that expired before the given time.
+func (s *RefreshTokenStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+func snapshotOf(t *models.Task) models.TaskSnapshot {
+	return models.TaskSnapshot{Title: t.Title, Description: t.Description, Status: t.Status, DueAt: t.DueAt}
+}
+
+// formatDue renders a due date for the change log, "" meaning no due date.
+func formatDue(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// diffTask lists the fields that differ between two versions of a task.
+func diffTask(old, new models.TaskSnapshot) []models.FieldChange {
+	changes := []models.FieldChange{}
+	if old.Title != new.Title {
+		changes = append(changes, models.FieldChange{Field: "title", Old: old.Title, New: new.Title})
+	}
+	if old.Description != new.Description {
+		changes = append(changes, models.FieldChange{Field: "description", Old: old.Description, New: new.Description})
+	}
+	if old.Status != new.Status {
+		changes = append(changes, models.FieldChange{Field: "status", Old: old.Status, New: new.Status})
+	}
+	if formatDue(old.DueAt) != formatDue(new.DueAt) {
+		changes = append(changes, models.FieldChange{Field: "due_at", Old: formatDue(old.DueAt), New: formatDue(new.DueAt)})
+	}
+	return changes
+}
+
+func insertRevision(ctx context.Context, tx pgx.Tx, t *models.Task, actorID int, changes []models.FieldChange) error {
+	query := `INSERT INTO task_revisions (task_id, revision, actor_id, changes, snapshot, created_at)
+			  VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6)`
+	_, err := tx.Exec(ctx, query, t.ID, t.Version, actorID, changes, snapshotOf(t), t.UpdatedAt)
+	return err
+}
+
+const revisionColumns = `task_id, revision, actor_id, changes, snapshot, created_at`
+
+func scanRevision(row pgx.Row) (*models.TaskRevision, error) {
+	r := &models.TaskRevision{}
+	err := row.Scan(&r.TaskID, &r.Revision, &r.ActorID, &r.Changes, &r.Snapshot, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// History returns every revision of the task, oldest first.
+func (s *TaskStore) History(ctx context.Context, taskID int) ([]*models.TaskRevision, error) {
+	query := `SELECT ` + revisionColumns + ` FROM task_revisions WHERE task_id = $1 ORDER BY revision`
+	rows, err := s.db.Query(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.TaskRevision{}
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// Revision returns revision n of the task.
+func (s *TaskStore) Revision(ctx context.Context, taskID, n int) (*models.TaskRevision, error) {
+	query := `SELECT ` + revisionColumns + ` FROM task_revisions WHERE task_id = $1 AND revision = $2`
+	return scanRevision(s.db.QueryRow(ctx, query, taskID, n))
+}
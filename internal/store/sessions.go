@@ -0,0 +1,152 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// SessionStore keeps the login sessions of users. Each session owns a family
+// of refresh tokens.
+type SessionStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewSessionStore(pool *pgxpool.Pool) *SessionStore {
+	return &SessionStore{Pool: pool}
+}
+
+const sessionColumns = `id, user_id, family_id, user_agent, ip, created_at, last_used_at, revoked_at`
+
+func scanSession(row pgx.Row) (*models.Session, error) {
+	s := &models.Session{}
+	err := row.Scan(&s.ID, &s.UserID, &s.FamilyID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SessionStore) Create(ctx context.Context, sess *models.Session) error {
+	query := `INSERT INTO sessions (user_id, family_id, user_agent, ip) VALUES ($1, $2, $3, $4)
+			  RETURNING ` + sessionColumns
+	created, err := scanSession(s.Pool.QueryRow(ctx, query, sess.UserID, sess.FamilyID, sess.UserAgent, sess.IP))
+	if err != nil {
+		return err
+	}
+	*sess = *created
+	return nil
+}
+
+// Touch records that the session of the refresh token family was used from the
+// given device. It returns pgx.ErrNoRows for revoked sessions.
+func (s *SessionStore) Touch(ctx context.Context, familyID, userAgent, ip string) (*models.Session, error) {
+	query := `UPDATE sessions SET last_used_at = now(), user_agent = $2, ip = $3
+			  WHERE family_id = $1 AND revoked_at IS NULL
+			  RETURNING ` + sessionColumns
+	return scanSession(s.Pool.QueryRow(ctx, query, familyID, userAgent, ip))
+}
+
+// List returns the user's sessions that are neither revoked nor used last
+// before activeSince, most recently used first.
+func (s *SessionStore) List(ctx context.Context, userID int, activeSince time.Time) ([]*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+			  WHERE user_id = $1 AND revoked_at IS NULL AND last_used_at >= $2
+			  ORDER BY last_used_at DESC, id DESC`
+	rows, err := s.Pool.Query(ctx, query, userID, activeSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke revokes the user's session and its refresh tokens. It returns
+// pgx.ErrNoRows if there is no such session or it's already revoked.
+func (s *SessionStore) Revoke(ctx context.Context, userID, id int) (*models.Session, error) {
+	revoked, err := s.revoke(ctx, `user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(revoked) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return revoked[0], nil
+}
+
+// RevokeFamily revokes the session owning the refresh token family.
+func (s *SessionStore) RevokeFamily(ctx context.Context, familyID string) ([]*models.Session, error) {
+	return s.revoke(ctx, `family_id = $1`, familyID)
+}
+
+// RevokeAll revokes every session of the user.
+func (s *SessionStore) RevokeAll(ctx context.Context, userID int) ([]*models.Session, error) {
+	return s.revoke(ctx, `user_id = $1`, userID)
+}
+
+// RevokeOthers revokes every session of the user but the one with the given id.
+func (s *SessionStore) RevokeOthers(ctx context.Context, userID, keepID int) ([]*models.Session, error) {
+	return s.revoke(ctx, `user_id = $1 AND id <> $2`, userID, keepID)
+}
+
+// revoke revokes the active sessions matching where together with their
+// refresh tokens and returns them.
+func (s *SessionStore) revoke(ctx context.Context, where string, args ...interface{}) ([]*models.Session, error) {
+	var revoked []*models.Session
+	err := pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		var err error
+		revoked, err = revokeSessions(ctx, tx, where, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// revokeSessions is SessionStore.revoke within the transaction tx.
+func revokeSessions(ctx context.Context, tx pgx.Tx, where string, args ...interface{}) ([]*models.Session, error) {
+	rows, err := tx.Query(ctx, `UPDATE sessions SET revoked_at = now()
+		WHERE `+where+` AND revoked_at IS NULL RETURNING `+sessionColumns, args...)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Session, error) {
+		return scanSession(row)
+	})
+	if err != nil || len(revoked) == 0 {
+		return []*models.Session{}, err
+	}
+
+	families := make([]string, len(revoked))
+	for i, sess := range revoked {
+		families[i] = sess.FamilyID
+	}
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = now()
+		WHERE family_id = ANY($1) AND revoked_at IS NULL`, families)
+	if err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// DeleteExpired removes sessions last used before the given time, together
+// with their refresh tokens.
+func (s *SessionStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM sessions WHERE last_used_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
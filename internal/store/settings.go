@@ -0,0 +1,38 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SettingsStore keeps the workspace settings.
+type SettingsStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewSettingsStore(pool *pgxpool.Pool) *SettingsStore {
+	return &SettingsStore{Pool: pool}
+}
+
+const settingsColumns = `mfa_required, updated_at, updated_by`
+
+func scanSettings(row pgx.Row) (*models.WorkspaceSettings, error) {
+	ws := &models.WorkspaceSettings{}
+	if err := row.Scan(&ws.MFARequired, &ws.UpdatedAt, &ws.UpdatedBy); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (s *SettingsStore) Get(ctx context.Context) (*models.WorkspaceSettings, error) {
+	return scanSettings(s.Pool.QueryRow(ctx, `SELECT `+settingsColumns+` FROM workspace_settings`))
+}
+
+// SetMFARequired changes whether 2FA is required, recording the admin doing it.
+func (s *SettingsStore) SetMFARequired(ctx context.Context, required bool, by int) (*models.WorkspaceSettings, error) {
+	query := `UPDATE workspace_settings SET mfa_required = $1, updated_at = now(), updated_by = $2
+			  RETURNING ` + settingsColumns
+	return scanSettings(s.Pool.QueryRow(ctx, query, required, by))
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// signingKeyLock is the advisory lock serializing key rotation across servers.
+const signingKeyLock = 7_043_001
+
+type SigningKeyStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewSigningKeyStore(pool *pgxpool.Pool) *SigningKeyStore {
+	return &SigningKeyStore{Pool: pool}
+}
+
+const signingKeyColumns = `kid, algorithm, private_key, public_key, encrypted, created_at, activates_at, expires_at`
+
+func scanSigningKey(row pgx.Row) (*models.SigningKey, error) {
+	k := &models.SigningKey{}
+	err := row.Scan(&k.KID, &k.Algorithm, &k.PrivateKey, &k.PublicKey, &k.Encrypted, &k.CreatedAt, &k.ActivatesAt, &k.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// List returns the keys that haven't expired, the most recently activated first.
+func (s *SigningKeyStore) List(ctx context.Context) ([]*models.SigningKey, error) {
+	query := `SELECT ` + signingKeyColumns + ` FROM signing_keys
+			  WHERE expires_at IS NULL OR expires_at > now()
+			  ORDER BY activates_at DESC`
+	rows, err := s.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.SigningKey, error) {
+		return scanSigningKey(row)
+	})
+}
+
+// SealPrivateKey replaces the plain private key of kid with its encryption.
+// Keys encrypted meanwhile by another server are left alone.
+func (s *SigningKeyStore) SealPrivateKey(ctx context.Context, kid string, sealed []byte) error {
+	_, err := s.Pool.Exec(ctx, `UPDATE signing_keys SET private_key = $2, encrypted = true
+		WHERE kid = $1 AND NOT encrypted`, kid, sealed)
+	return err
+}
+
+// Rotate adds a key from generate unless a key was activated after due, or is
+// still waiting for activation. The new key activates after the delay, or right
+// away if there is no key yet. Keys it replaces expire grace after that. It
+// reports whether a key was added.
+func (s *SigningKeyStore) Rotate(ctx context.Context, due time.Time, delay, grace time.Duration,
+	generate func() (*models.SigningKey, error)) (bool, error) {
+	rotated := false
+	err := pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, signingKeyLock); err != nil {
+			return err
+		}
+
+		var latest *time.Time
+		if err := tx.QueryRow(ctx, `SELECT max(activates_at) FROM signing_keys`).Scan(&latest); err != nil {
+			return err
+		}
+		if latest != nil && latest.After(due) {
+			return nil
+		}
+
+		key, err := generate()
+		if err != nil {
+			return err
+		}
+		if latest == nil {
+			delay = 0
+		}
+		query := `INSERT INTO signing_keys (kid, algorithm, private_key, public_key, encrypted, activates_at)
+				  VALUES ($1, $2, $3, $4, $5, now() + $6::interval)`
+		if _, err := tx.Exec(ctx, query, key.KID, key.Algorithm, key.PrivateKey, key.PublicKey, key.Encrypted,
+			delay); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE signing_keys SET expires_at = now() + $1::interval + $2::interval
+			WHERE expires_at IS NULL AND kid <> $3`, delay, grace, key.KID)
+		rotated = err == nil
+		return err
+	})
+	return rotated, err
+}
@@ -4,80 +4,330 @@ import (
 	"GoProjects/TaskTracker/internal/logger"
 	"GoProjects/TaskTracker/internal/models"
 	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
+	"strings"
+	"time"
 )
 
 type TaskStore struct {
 	Pool *pgxpool.Pool
+	db   dbtx
 }
 
 func NewTaskStore(pool *pgxpool.Pool) *TaskStore {
-	return &TaskStore{Pool: pool}
+	return &TaskStore{Pool: pool, db: pool}
 }
 
-// Create
-func (s *TaskStore) Create(ctx context.Context, t *models.Task) error {
-	query := `INSERT INTO tasks (title, description, status, user_id) 
-			  VALUES ($1, $2, $3, $4) returning id, user_id, created_at, updated_at;`
-	return s.Pool.QueryRow(ctx, query, t.Title, t.Description, t.Status, t.UserID).Scan(&t.ID, &t.UserID, &t.CreatedAt, &t.UpdatedAt)
+// InTx runs fn with a store bound to a single transaction. The transaction is
+// committed when fn returns nil and rolled back otherwise.
+func (s *TaskStore) InTx(ctx context.Context, fn func(tx *TaskStore) error) error {
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		return fn(&TaskStore{Pool: s.Pool, db: tx})
+	})
 }
 
-// Get by id
-func (s *TaskStore) Get(ctx context.Context, id int) (t *models.Task, err error) {
-	t = &models.Task{}
-	query := `SELECT id, title, description, status, user_id, created_at, updated_at FROM tasks WHERE id = $1;`
-	err = s.Pool.QueryRow(ctx, query, id).Scan(
-		&t.ID, &t.Title, &t.Description, &t.Status, &t.UserID, &t.CreatedAt, &t.UpdatedAt)
+// taskColumns selects a task together with its checklist progress. It is also
+// used in RETURNING clauses, so the subqueries refer to the table by name.
+const taskColumns = `id, title, description, status, user_id, version, created_at, updated_at, deleted_at, due_at, rank,
+	(SELECT count(*) FILTER (WHERE checked) FROM checklist_items c WHERE c.task_id = tasks.id),
+	(SELECT count(*) FROM checklist_items c WHERE c.task_id = tasks.id)`
+
+func scanTask(row pgx.Row) (*models.Task, error) {
+	t := &models.Task{}
+	err := row.Scan(&t.ID, &t.Title, &t.Description, &t.Status, &t.UserID, &t.Version, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt, &t.DueAt, &t.Rank,
+		&t.Checklist.Done, &t.Checklist.Total)
 	if err != nil {
 		return nil, err
 	}
 	return t, nil
 }
 
-// List all
-func (s *TaskStore) List(ctx context.Context, userID int) ([]*models.Task, error) {
-	query := `SELECT id, title, description, status, user_id, created_at, updated_at FROM tasks where user_id = $1`
-	rows, err := s.Pool.Query(ctx, query, userID)
+// Create inserts the task at the bottom of its board column and records its first
+// revision on behalf of its owner. It returns ErrWIPLimit when the column is full.
+func (s *TaskStore) Create(ctx context.Context, t *models.Task) error {
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if err := checkWIP(ctx, tx, t.UserID, t.Status, 0); err != nil {
+			return err
+		}
+		r, err := appendRank(ctx, tx, t.UserID, t.Status)
+		if err != nil {
+			return err
+		}
+		t.Rank = r
+
+		query := `INSERT INTO tasks (title, description, status, user_id, due_at, rank) 
+				  VALUES ($1, $2, $3, $4, $5, $6) returning id, user_id, version, created_at, updated_at;`
+		err = tx.QueryRow(ctx, query, t.Title, t.Description, t.Status, t.UserID, t.DueAt, t.Rank).Scan(&t.ID, &t.UserID, &t.Version, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return insertRevision(ctx, tx, t, t.UserID, diffTask(models.TaskSnapshot{}, snapshotOf(t)))
+	})
+}
+
+// Get by id. Tasks in the trash are not found.
+func (s *TaskStore) Get(ctx context.Context, id int) (*models.Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE id = $1 AND deleted_at IS NULL;`
+	return scanTask(s.db.QueryRow(ctx, query, id))
+}
+
+// TaskFilter narrows down the tasks returned by List and Stream.
+type TaskFilter struct {
+	UserID int
+	// Status matches tasks in exactly this status when set.
+	Status string
+	// Query matches tasks whose title or description contains it, case-insensitively.
+	Query string
+	// DueOnly matches only tasks that have a due date.
+	DueOnly bool
+}
+
+func (f TaskFilter) where() (string, []interface{}) {
+	conds := []string{"user_id = $1", "deleted_at IS NULL"}
+	args := []interface{}{f.UserID}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if f.Query != "" {
+		args = append(args, "%"+likeEscaper.Replace(f.Query)+"%")
+		conds = append(conds, fmt.Sprintf("(title ILIKE $%d OR description ILIKE $%d)", len(args), len(args)))
+	}
+	if f.DueOnly {
+		conds = append(conds, "due_at IS NOT NULL")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
 
+// List all except trashed
+func (s *TaskStore) List(ctx context.Context, f TaskFilter) ([]*models.Task, error) {
+	tasks := []*models.Task{}
+	err := s.Stream(ctx, f, func(t *models.Task) error {
+		tasks = append(tasks, t)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return tasks, nil
+}
+
+// Stream calls fn for every matching task straight from the database cursor,
+// without loading the whole result into memory. It stops at the first error fn returns.
+func (s *TaskStore) Stream(ctx context.Context, f TaskFilter, fn func(*models.Task) error) error {
+	where, args := f.where()
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE ` + where + ` ORDER BY id`
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
 
-	tasks := []*models.Task{}
 	for rows.Next() {
-		t := &models.Task{}
-		err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.Status, &t.UserID, &t.CreatedAt, &t.UpdatedAt)
+		t, err := scanTask(rows)
 		if err != nil {
 			logger.Log.Error("Scan error", zap.Error(err))
 			continue
 		}
-		tasks = append(tasks, t)
+		if err := fn(t); err != nil {
+			return err
+		}
 	}
-	return tasks, nil
+	return rows.Err()
+}
+
+// Update overwrites the task if it is still at expectedVersion and records the
+// changed fields as a new revision made by actorID. It returns ErrVersionConflict
+// when the task was changed in the meantime.
+func (s *TaskStore) Update(ctx context.Context, actorID int, t *models.Task, expectedVersion int) (*models.Task, error) {
+	return s.Patch(ctx, actorID, t.ID, snapshotOf(t).Patch(), expectedVersion)
 }
 
-// Update
-func (s *TaskStore) Update(ctx context.Context, t *models.Task) (*models.Task, error) {
-	query := `
-        UPDATE tasks
-        SET title=$1, description=$2, status=$3, updated_at=now()
-        WHERE id=$4
-        RETURNING id, title, description, status, user_id, created_at, updated_at
-    `
-	var updated models.Task
-	err := s.Pool.QueryRow(ctx, query, t.Title, t.Description, t.Status, t.ID).
-		Scan(&updated.ID, &updated.Title, &updated.Description, &updated.Status, &updated.UserID, &updated.CreatedAt, &updated.UpdatedAt)
+// Patch updates only the columns present in the patch, bumps the version and
+// records the changed fields as a new revision made by actorID. When
+// expectedVersion is positive the update is conditional on it and
+// ErrVersionConflict is returned if the task was changed in the meantime.
+// A patch that changes nothing leaves the task and its version untouched.
+// A task whose status changes goes to the bottom of its new board column,
+// unless that column is at its WIP limit, in which case ErrWIPLimit is returned.
+func (s *TaskStore) Patch(ctx context.Context, actorID, id int, p models.TaskPatch, expectedVersion int) (*models.Task, error) {
+	var updated *models.Task
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := scanTask(tx.QueryRow(ctx, `SELECT `+taskColumns+` FROM tasks WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id))
+		if err != nil {
+			return err
+		}
+		if expectedVersion > 0 && current.Version != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		next := snapshotOf(current)
+		if p.Title != nil {
+			next.Title = *p.Title
+		}
+		if p.Description != nil {
+			next.Description = *p.Description
+		}
+		if p.Status != nil {
+			next.Status = *p.Status
+		}
+		if p.DueAt.Set {
+			next.DueAt = p.DueAt.Time
+		}
+		changes := diffTask(snapshotOf(current), next)
+		if len(changes) == 0 {
+			updated = current
+			return nil
+		}
+
+		var sets []string
+		var args []interface{}
+		for _, c := range changes {
+			args = append(args, snapshotValue(next, c.Field))
+			sets = append(sets, fmt.Sprintf("%s = $%d", c.Field, len(args)))
+		}
+		if next.Status != current.Status {
+			if err := checkWIP(ctx, tx, current.UserID, next.Status, id); err != nil {
+				return err
+			}
+			r, err := appendRank(ctx, tx, current.UserID, next.Status)
+			if err != nil {
+				return err
+			}
+			args = append(args, r)
+			sets = append(sets, fmt.Sprintf("rank = $%d", len(args)))
+		}
+		sets = append(sets, "version = version + 1", "updated_at = now()")
+		args = append(args, id)
+
+		query := fmt.Sprintf(`UPDATE tasks SET %s WHERE id = $%d RETURNING %s`, strings.Join(sets, ", "), len(args), taskColumns)
+		updated, err = scanTask(tx.QueryRow(ctx, query, args...))
+		if err != nil {
+			return err
+		}
+		return insertRevision(ctx, tx, updated, actorID, changes)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &updated, nil
+	return updated, nil
 }
 
-// Delete
+// snapshotValue returns the column value of a field changed by Patch.
+func snapshotValue(s models.TaskSnapshot, field string) interface{} {
+	switch field {
+	case "title":
+		return s.Title
+	case "description":
+		return s.Description
+	case "status":
+		return s.Status
+	case "due_at":
+		return s.DueAt
+	}
+	panic("unknown task field " + field)
+}
+
+// Delete moves the task to the trash. Trashed tasks are hidden from Get and List
+// until they are restored or purged.
 func (s *TaskStore) Delete(ctx context.Context, id int) error {
-	query := `DELETE FROM tasks WHERE id=$1`
-	_, err := s.Pool.Exec(ctx, query, id)
-	return err
+	query := `UPDATE tasks SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL`
+	tag, err := s.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ListTrash returns the user's trashed tasks, most recently deleted first.
+func (s *TaskStore) ListTrash(ctx context.Context, userID int) ([]*models.Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*models.Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// Restore takes the user's task out of the trash, back into its column. It
+// returns ErrWIPLimit when the column is full.
+func (s *TaskStore) Restore(ctx context.Context, id, userID int) (*models.Task, error) {
+	var restored *models.Task
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		var status string
+		err := tx.QueryRow(ctx, `SELECT status FROM tasks WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL FOR UPDATE`,
+			id, userID).Scan(&status)
+		if err != nil {
+			return err
+		}
+		if err := checkWIP(ctx, tx, userID, status, id); err != nil {
+			return err
+		}
+
+		query := `UPDATE tasks SET deleted_at = NULL, updated_at = now()
+				  WHERE id = $1
+				  RETURNING ` + taskColumns
+		restored, err = scanTask(tx.QueryRow(ctx, query, id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// PurgeDeleted permanently removes up to limit tasks trashed before the given
+// time, oldest first, and returns them. Tasks restored meanwhile are skipped.
+// Their attachments go with them; the files are queued in blob_deletions. It
+// is meant to run in InTx, so that the purge is all or nothing.
+func (s *TaskStore) PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*models.Task, error) {
+	rows, err := s.db.Query(ctx, `SELECT id FROM tasks WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2 FOR UPDATE`,
+		before, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	query := `WITH gone AS (DELETE FROM task_attachments WHERE task_id = ANY($1) RETURNING storage_key)
+			  INSERT INTO blob_deletions (storage_key) SELECT storage_key FROM gone ON CONFLICT DO NOTHING`
+	if _, err := s.db.Exec(ctx, query, ids); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(ctx, `DELETE FROM tasks WHERE id = ANY($1) RETURNING `+taskColumns, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purged []*models.Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		purged = append(purged, t)
+	}
+	return purged, rows.Err()
 }
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"GoProjects/TaskTracker/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"math"
+	"time"
+)
+
+// ErrTimerRunning is returned by Start when the user already runs a timer.
+var ErrTimerRunning = errors.New("a timer is already running")
+
+type TimeStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewTimeStore(pool *pgxpool.Pool) *TimeStore {
+	return &TimeStore{Pool: pool}
+}
+
+const timeEntryColumns = `id, task_id, user_id, started_at, ended_at, note,
+	extract(epoch FROM coalesce(ended_at, now()) - started_at)::bigint, created_at`
+
+func scanTimeEntry(row pgx.Row) (*models.TimeEntry, error) {
+	e := &models.TimeEntry{}
+	err := row.Scan(&e.ID, &e.TaskID, &e.UserID, &e.StartedAt, &e.EndedAt, &e.Note, &e.Seconds, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Start starts a timer on the task. The unique index on running entries makes
+// sure a user never has two timers, even with concurrent requests.
+func (s *TimeStore) Start(ctx context.Context, taskID, userID int, note string) (*models.TimeEntry, error) {
+	query := `INSERT INTO time_entries (task_id, user_id, started_at, note) VALUES ($1, $2, now(), $3)
+			  RETURNING ` + timeEntryColumns
+	e, err := scanTimeEntry(s.Pool.QueryRow(ctx, query, taskID, userID, note))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrTimerRunning
+	}
+	return e, err
+}
+
+// Stop stops the user's running timer. It returns pgx.ErrNoRows when none runs.
+func (s *TimeStore) Stop(ctx context.Context, userID int) (*models.TimeEntry, error) {
+	query := `UPDATE time_entries SET ended_at = greatest(now(), started_at + interval '1 second')
+			  WHERE user_id = $1 AND ended_at IS NULL
+			  RETURNING ` + timeEntryColumns
+	return scanTimeEntry(s.Pool.QueryRow(ctx, query, userID))
+}
+
+// Running returns the user's running timer or pgx.ErrNoRows.
+func (s *TimeStore) Running(ctx context.Context, userID int) (*models.TimeEntry, error) {
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries WHERE user_id = $1 AND ended_at IS NULL`
+	return scanTimeEntry(s.Pool.QueryRow(ctx, query, userID))
+}
+
+// Create logs a finished entry.
+func (s *TimeStore) Create(ctx context.Context, e *models.TimeEntry) (*models.TimeEntry, error) {
+	query := `INSERT INTO time_entries (task_id, user_id, started_at, ended_at, note) VALUES ($1, $2, $3, $4, $5)
+			  RETURNING ` + timeEntryColumns
+	return scanTimeEntry(s.Pool.QueryRow(ctx, query, e.TaskID, e.UserID, e.StartedAt, e.EndedAt, e.Note))
+}
+
+// List returns the entries of the task, most recent first.
+func (s *TimeStore) List(ctx context.Context, taskID int) ([]*models.TimeEntry, error) {
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries WHERE task_id = $1 ORDER BY started_at DESC, id DESC`
+	rows, err := s.Pool.Query(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.TimeEntry{}
+	for rows.Next() {
+		e, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Delete removes the entry of the task.
+func (s *TimeStore) Delete(ctx context.Context, taskID, id int) error {
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM time_entries WHERE id = $1 AND task_id = $2`, id, taskID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// reportEntries clips the entries on the owner's tasks to [$2, $3). Running
+// timers count up to now. Tasks in the trash are left out.
+const reportEntries = `WITH entries AS (
+	SELECT e.task_id, e.user_id,
+	       greatest(e.started_at, $2) AS s,
+	       least(coalesce(e.ended_at, now()), $3) AS e
+	FROM time_entries e JOIN tasks t ON t.id = e.task_id
+	WHERE t.user_id = $1 AND t.deleted_at IS NULL AND e.started_at < $3 AND coalesce(e.ended_at, now()) > $2
+)`
+
+// Report sums up the time spent on the owner's tasks between from and to,
+// grouped by models.TimeReportByTask, ByUser or ByDay. Days are taken in loc.
+func (s *TimeStore) Report(ctx context.Context, ownerID int, from, to time.Time, groupBy string, loc *time.Location) ([]models.TimeReportRow, error) {
+	var query string
+	args := []interface{}{ownerID, from, to}
+	switch groupBy {
+	case models.TimeReportByTask:
+		query = reportEntries + `
+			SELECT entries.task_id::text, t.title, sum(extract(epoch FROM entries.e - entries.s))::bigint
+			FROM entries JOIN tasks t ON t.id = entries.task_id
+			GROUP BY entries.task_id, t.title ORDER BY entries.task_id`
+	case models.TimeReportByUser:
+		query = reportEntries + `
+			SELECT entries.user_id::text, u.email, sum(extract(epoch FROM entries.e - entries.s))::bigint
+			FROM entries JOIN users u ON u.id = entries.user_id
+			GROUP BY entries.user_id, u.email ORDER BY entries.user_id`
+	case models.TimeReportByDay:
+		// d is a local midnight; AT TIME ZONE turns it back into an instant.
+		query = reportEntries + `
+			SELECT to_char(d, 'YYYY-MM-DD'), '',
+			       sum(extract(epoch FROM least(entries.e, (d + interval '1 day') AT TIME ZONE $4)
+			                            - greatest(entries.s, d AT TIME ZONE $4)))::bigint
+			FROM entries,
+			     generate_series(date_trunc('day', entries.s AT TIME ZONE $4),
+			                     date_trunc('day', entries.e AT TIME ZONE $4), interval '1 day') d
+			WHERE least(entries.e, (d + interval '1 day') AT TIME ZONE $4) > greatest(entries.s, d AT TIME ZONE $4)
+			GROUP BY d ORDER BY d`
+		args = append(args, loc.String())
+	default:
+		return nil, fmt.Errorf("unknown grouping %q", groupBy)
+	}
+
+	rows, err := s.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []models.TimeReportRow{}
+	for rows.Next() {
+		var r models.TimeReportRow
+		if err := rows.Scan(&r.Key, &r.Label, &r.Seconds); err != nil {
+			return nil, err
+		}
+		r.Hours = math.Round(float64(r.Seconds)/36) / 100
+		report = append(report, r)
+	}
+	return report, rows.Err()
+}
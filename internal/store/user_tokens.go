@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// UserTokenStore keeps the single-use tokens sent to users by email.
+type UserTokenStore struct {
+	Pool *pgxpool.Pool
+}
+
+func NewUserTokenStore(pool *pgxpool.Pool) *UserTokenStore {
+	return &UserTokenStore{Pool: pool}
+}
+
+// Create stores a token for the purpose, one of models.TokenPasswordReset and
+// TokenEmailVerification, sent to email. Earlier unused tokens of the user for
+// the same purpose stop working.
+func (s *UserTokenStore) Create(ctx context.Context, userID int, purpose, email, tokenHash string, expiresAt time.Time) error {
+	return pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `UPDATE user_tokens SET used_at = now()
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, purpose)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO user_tokens (user_id, purpose, email, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4, $5)`, userID, purpose, email, tokenHash, expiresAt)
+		return err
+	})
+}
+
+// Consume spends the token and returns its user and the address it was sent
+// to. It returns pgx.ErrNoRows for unknown, used and expired tokens, and for
+// tokens sent to an address the user no longer has.
+func (s *UserTokenStore) Consume(ctx context.Context, purpose, tokenHash string) (int, string, error) {
+	var userID int
+	var email string
+	query := `UPDATE user_tokens t SET used_at = now()
+			  FROM users u
+			  WHERE t.token_hash = $1 AND t.purpose = $2 AND t.used_at IS NULL AND t.expires_at > now()
+			    AND u.id = t.user_id AND u.email = t.email
+			  RETURNING t.user_id, t.email`
+	err := s.Pool.QueryRow(ctx, query, tokenHash, purpose).Scan(&userID, &email)
+	return userID, email, err
+}
+
+// DeleteExpired removes tokens that expired before the given time.
+func (s *UserTokenStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM user_tokens WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -4,10 +4,16 @@ import (
 	"GoProjects/TaskTracker/internal/logger"
 	"GoProjects/TaskTracker/internal/models"
 	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
 
+// ErrEmailTaken is returned when another user has the email address already.
+var ErrEmailTaken = errors.New("email address already in use")
+
 type UserStore struct {
 	Pool *pgxpool.Pool
 }
@@ -16,46 +22,46 @@ func NewUserStore(pool *pgxpool.Pool) *UserStore {
 	return &UserStore{Pool: pool}
 }
 
+const userColumns = `id, email, name, password, role, created_at, email_verified_at`
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	u := &models.User{}
+	if err := row.Scan(&u.ID, &u.Email, &u.Name, &u.Password, &u.Role, &u.CreatedAt, &u.EmailVerifiedAt); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 // Create
 func (s *UserStore) Create(ctx context.Context, t *models.User) error {
-	query := `INSERT INTO users (email, password) values ($1, $2) returning id, created_at`
-	return s.Pool.QueryRow(ctx, query, t.Email, t.Password).Scan(&t.ID, &t.CreatedAt)
+	query := `INSERT INTO users (email, password, name) values ($1, $2, $3) returning id, role, created_at`
+	err := s.Pool.QueryRow(ctx, query, t.Email, t.Password, t.Name).Scan(&t.ID, &t.Role, &t.CreatedAt)
+	return uniqueEmail(err)
 }
 
 // Get by id
 func (s *UserStore) Get(ctx context.Context, id int) (*models.User, error) {
-	u := &models.User{}
-	query := `SELECT id, email, password, created_at FROM users WHERE id = $1;`
-	err := s.Pool.QueryRow(ctx, query, id).Scan(&u.ID, &u.Email, &u.Password, &u.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return u, nil
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1;`
+	return scanUser(s.Pool.QueryRow(ctx, query, id))
 }
 
 // Get by email
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
-	u := &models.User{}
-	query := `SELECT id, email, password, created_at FROM users WHERE email = $1;`
-	err := s.Pool.QueryRow(ctx, query, email).Scan(&u.ID, &u.Email, &u.Password, &u.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return u, nil
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1;`
+	return scanUser(s.Pool.QueryRow(ctx, query, email))
 }
 
 // Get all users
 func (s *UserStore) List(ctx context.Context) ([]*models.User, error) {
-	query := `SELECT id, email, password, created_at FROM users;`
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY id;`
 	rows, err := s.Pool.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var users []*models.User
+	users := []*models.User{}
 	for rows.Next() {
-		u := &models.User{}
-		err := rows.Scan(&u.ID, &u.Email, &u.Password, &u.CreatedAt)
+		u, err := scanUser(rows)
 		if err != nil {
 			logger.Log.Error("scan error", zap.Error(err))
 			continue
@@ -65,19 +71,77 @@ func (s *UserStore) List(ctx context.Context) ([]*models.User, error) {
 	return users, nil
 }
 
-// Update
-func (s *UserStore) Update(ctx context.Context, t *models.User) (*models.User, error) {
-	query := `UPDATE users 
-		 	  SET email = $1, password = $2 
-		 	  WHERE id = $3
-			  returning id, email, password, created_at;`
-	var updated models.User
-	err := s.Pool.QueryRow(ctx, query, t.Email, t.Password, t.ID).
-		Scan(&updated.ID, &updated.Email, &updated.Password, &updated.CreatedAt)
+// UpdateProfile sets the name and email of the user. A changed email address
+// has to be verified again, and the tokens emailed to the old one stop working.
+func (s *UserStore) UpdateProfile(ctx context.Context, id int, name, email string) (*models.User, error) {
+	var u *models.User
+	err := pgx.BeginFunc(ctx, s.Pool, func(tx pgx.Tx) error {
+		query := `UPDATE users
+				  SET name = $2, email = $3,
+				      email_verified_at = CASE WHEN email = $3 THEN email_verified_at END
+				  WHERE id = $1
+				  RETURNING ` + userColumns
+		var err error
+		if u, err = scanUser(tx.QueryRow(ctx, query, id, name, email)); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE user_tokens SET used_at = now()
+			WHERE user_id = $1 AND used_at IS NULL AND email IS DISTINCT FROM $2`, id, email)
+		return err
+	})
+	return u, uniqueEmail(err)
+}
+
+// uniqueEmail turns the violation of the unique email constraint into ErrEmailTaken.
+func uniqueEmail(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// SetRole changes the role of the user, one of models.RoleUser and RoleAdmin.
+func (s *UserStore) SetRole(ctx context.Context, id int, role string) (*models.User, error) {
+	query := `UPDATE users SET role = $2 WHERE id = $1 RETURNING ` + userColumns
+	return scanUser(s.Pool.QueryRow(ctx, query, id, role))
+}
+
+// PromoteAdmins makes the users with the given verified email addresses admins
+// and returns how many weren't yet.
+func (s *UserStore) PromoteAdmins(ctx context.Context, emails []string) (int64, error) {
+	tag, err := s.Pool.Exec(ctx, `UPDATE users SET role = 'admin'
+		WHERE lower(email) = ANY($1) AND email_verified_at IS NOT NULL AND role <> 'admin'`, emails)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SetPassword replaces the password hash of the user.
+func (s *UserStore) SetPassword(ctx context.Context, id int, hash string) error {
+	tag, err := s.Pool.Exec(ctx, `UPDATE users SET password = $2 WHERE id = $1`, id, hash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user confirmed the email address. It
+// returns pgx.ErrNoRows if the user's address is no longer email.
+func (s *UserStore) MarkEmailVerified(ctx context.Context, id int, email string) error {
+	tag, err := s.Pool.Exec(ctx, `UPDATE users SET email_verified_at = coalesce(email_verified_at, now())
+		WHERE id = $1 AND email = $2`, id, email)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
 	}
-	return &updated, nil
+	return nil
 }
 
 // Delete
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS task_revisions;
+DROP FUNCTION IF EXISTS task_revisions_immutable();
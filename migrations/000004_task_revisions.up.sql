@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS task_revisions (
+    id SERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+    changes JSONB NOT NULL DEFAULT '[]',
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    UNIQUE (task_id, revision)
+);
+
+-- Revisions are append-only: rows may only disappear together with their task.
+CREATE OR REPLACE FUNCTION task_revisions_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'task_revisions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER task_revisions_no_update
+    BEFORE UPDATE ON task_revisions
+    FOR EACH ROW EXECUTE FUNCTION task_revisions_immutable();
+
+-- Baseline revision for tasks that existed before history was recorded.
+INSERT INTO task_revisions (task_id, revision, actor_id, snapshot, created_at)
+SELECT id, version, user_id,
+       jsonb_build_object('title', title, 'description', COALESCE(description, ''), 'status', status),
+       updated_at
+FROM tasks
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS board_columns;
+DROP INDEX IF EXISTS tasks_board_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS rank;
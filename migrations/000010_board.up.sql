@@ -0,0 +1,18 @@
+-- Ranks are compared byte by byte, so the column must not use a linguistic collation.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS rank TEXT COLLATE "C" NOT NULL DEFAULT '';
+
+UPDATE tasks t SET rank = r.rank
+FROM (
+    SELECT id, lpad(row_number() OVER (PARTITION BY user_id, status ORDER BY id)::text, 10, '0') || 'V' AS rank
+    FROM tasks
+) r
+WHERE t.id = r.id;
+
+CREATE INDEX IF NOT EXISTS tasks_board_idx ON tasks (user_id, status, rank) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS board_columns (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    wip_limit INT,
+    PRIMARY KEY (user_id, status)
+);
@@ -0,0 +1,14 @@
+-- Keys signing access tokens. Private keys are PKCS #8, public keys PKIX (DER).
+CREATE TABLE IF NOT EXISTS signing_keys (
+    kid TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key BYTEA NOT NULL,
+    public_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- keys are published before they start signing, so verifiers learn them in time
+    activates_at TIMESTAMPTZ NOT NULL,
+    -- set once a newer key took over, after the last tokens signed with it expired
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS signing_keys_activates_at_idx ON signing_keys (activates_at);
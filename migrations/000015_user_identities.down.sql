@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_lower_email_idx;
+DROP TABLE IF EXISTS user_identities;
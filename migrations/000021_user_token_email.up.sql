@@ -0,0 +1,4 @@
+-- Tokens are bound to the address they were sent to. Pending tokens from
+-- before can't tell which that was and stop working.
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS email TEXT;
+UPDATE user_tokens SET used_at = now() WHERE used_at IS NULL;
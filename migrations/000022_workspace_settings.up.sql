@@ -0,0 +1,10 @@
+-- Settings of the workspace, i.e. the whole installation, kept in one row.
+CREATE TABLE IF NOT EXISTS workspace_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    mfa_required BOOLEAN NOT NULL DEFAULT false,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- no foreign key: the admin may be deleted later
+    updated_by INT
+);
+
+INSERT INTO workspace_settings DEFAULT VALUES ON CONFLICT DO NOTHING;
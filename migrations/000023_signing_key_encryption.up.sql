@@ -0,0 +1,3 @@
+-- Private keys are encrypted with JWT_KEY_ENCRYPTION_KEY. Keys stored before
+-- are encrypted by the first server that loads them.
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT false;
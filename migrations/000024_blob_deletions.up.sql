@@ -0,0 +1,7 @@
+-- Files of attachments whose rows were deleted or purged. The rows go in the
+-- transaction that deletes the attachment or purges its task; the files are
+-- deleted afterwards, and retried from here until the blob store confirms.
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    storage_key TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);